@@ -12,6 +12,8 @@ type deployOptions struct {
 	project string
 	target  string
 	file    string
+	dryRun  bool
+	json    bool
 }
 
 func registerDeployCmd(rootCmd *cobra.Command) {
@@ -31,14 +33,26 @@ func registerDeployCmd(rootCmd *cobra.Command) {
 			params.Project = deployArgs.project
 			params.Target = deployArgs.target
 
+			if deployArgs.dryRun {
+				plan, err := deployments.PlanDeploy(params)
+				if err != nil {
+					return err
+				}
+
+				return writePlan(cmd, plan, deployArgs.json)
+			}
+
 			return deployments.Deploy(params)
 		},
 	}
 
-	deployCmd.Flags().StringVarP(&deployArgs.project, "project", "p", "", "Project to deploy")
+	deployCmd.Flags().StringVarP(&deployArgs.project, "project", "p", "", "The project to deploy. Projects should be in the @workspace/project format -e.g. @org/traefik.")
 	deployCmd.Flags().StringVarP(&deployArgs.target, "target", "t", "", "Target to deploy to")
 	deployCmd.Flags().StringVarP(&deployArgs.file, "file", "f", "", "Files to deploy")
 
+	deployCmd.Flags().BoolVar(&deployArgs.dryRun, "dry-run", false, "Print the plan without executing anything or writing to vaults")
+	deployCmd.Flags().BoolVar(&deployArgs.json, "json", false, "Print the dry run plan as json")
+
 	rootCmd.AddCommand(deployCmd)
 }
 
@@ -0,0 +1,310 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jolt9dev/j9d/pkg/hosts"
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+type hostOptions struct {
+	user         string
+	port         int
+	identity     string
+	hostKeyCheck string
+	file         string
+	force        bool
+	install      bool
+	json         bool
+}
+
+func registerHostCmd(rootCmd *cobra.Command) {
+	// hostCmd represents the host command group
+	var hostCmd = &cobra.Command{
+		Use:   "host",
+		Short: "manages the ssh hosts in the global config",
+		Long:  `The host command manages the ssh hosts in the global config. j9d files reference hosts by name e.g. ssh: { host: "@prod-1" }`,
+	}
+
+	registerHostAddCmd(hostCmd)
+	registerHostListCmd(hostCmd)
+	registerHostRemoveCmd(hostCmd)
+	registerHostTestCmd(hostCmd)
+	registerHostKeygenCmd(hostCmd)
+
+	rootCmd.AddCommand(hostCmd)
+}
+
+func registerHostAddCmd(hostCmd *cobra.Command) {
+	addArgs := hostOptions{}
+
+	var addCmd = &cobra.Command{
+		Use:   "add <name> <[user@]host[:port]>",
+		Short: "adds a host to the global config",
+		Long:  `The add command adds a host to the global config. The host may be an alias in ~/.ssh/config.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dest, err := ssh.ParseJumpHost(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid host %s: %w", args[1], err)
+			}
+
+			if addArgs.hostKeyCheck != "" {
+				_, err = ssh.ParseHostKeyMode(addArgs.hostKeyCheck)
+				if err != nil {
+					return err
+				}
+			}
+
+			h := types.Host{
+				Host:         dest.Host,
+				Port:         dest.Port,
+				User:         dest.User,
+				Identity:     addArgs.identity,
+				HostKeyCheck: addArgs.hostKeyCheck,
+			}
+
+			if addArgs.user != "" {
+				h.User = addArgs.user
+			}
+
+			if addArgs.port != 0 {
+				h.Port = addArgs.port
+			}
+
+			cfg, err := types.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			err = hosts.Add(cfg, args[0], h, addArgs.force)
+			if err != nil {
+				return err
+			}
+
+			err = types.SaveGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "added host @%s %s\n", hosts.NormalizeName(args[0]), hosts.Address(h))
+			return nil
+		},
+	}
+
+	addCmd.Flags().StringVarP(&addArgs.user, "user", "u", "", "The ssh user. Supercedes the user of the host argument.")
+	addCmd.Flags().IntVarP(&addArgs.port, "port", "p", 0, "The ssh port. Supercedes the port of the host argument.")
+	addCmd.Flags().StringVarP(&addArgs.identity, "identity", "i", "", "The private key used to connect")
+	addCmd.Flags().StringVar(&addArgs.hostKeyCheck, "host-key-check", "", "The host key checking of the host: strict, accept-new or off")
+	addCmd.Flags().BoolVar(&addArgs.force, "force", false, "Replace an existing host")
+
+	hostCmd.AddCommand(addCmd)
+}
+
+func registerHostListCmd(hostCmd *cobra.Command) {
+	listArgs := hostOptions{}
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "lists the hosts in the global config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := types.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			type hostItem struct {
+				Name string `json:"name"`
+				types.Host
+			}
+
+			items := []hostItem{}
+			for _, name := range sortedKeys(cfg.Hosts) {
+				items = append(items, hostItem{Name: name, Host: cfg.Hosts[name]})
+			}
+
+			if listArgs.json {
+				return writeJson(cmd, items)
+			}
+
+			rows := [][]string{}
+			for _, item := range items {
+				port := "-"
+				if item.Port != 0 {
+					port = strconv.Itoa(item.Port)
+				}
+
+				rows = append(rows, []string{"@" + item.Name, item.Host.Host, orDash(item.User), port, orDash(item.Identity)})
+			}
+
+			return writeTable(cmd, []string{"NAME", "HOST", "USER", "PORT", "IDENTITY"}, rows)
+		},
+	}
+
+	listCmd.Flags().BoolVar(&listArgs.json, "json", false, "Print the output as json")
+
+	hostCmd.AddCommand(listCmd)
+}
+
+func registerHostRemoveCmd(hostCmd *cobra.Command) {
+	var removeCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Short: "removes a host from the global config",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := types.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			if !hosts.Remove(cfg, args[0]) {
+				return fmt.Errorf("host @%s not found", hosts.NormalizeName(args[0]))
+			}
+
+			err = types.SaveGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "removed host @%s\n", hosts.NormalizeName(args[0]))
+			return nil
+		},
+	}
+
+	hostCmd.AddCommand(removeCmd)
+}
+
+func registerHostTestCmd(hostCmd *cobra.Command) {
+	testArgs := hostOptions{}
+
+	var testCmd = &cobra.Command{
+		Use:   "test <name>",
+		Short: "connects to a host and reports the latency and remote os",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := types.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			h, err := hosts.Get(cfg, args[0])
+			if err != nil {
+				return err
+			}
+
+			result, err := hosts.Test(args[0], h)
+			if err != nil {
+				return fmt.Errorf("host @%s failed: %w", hosts.NormalizeName(args[0]), err)
+			}
+
+			if testArgs.json {
+				return writeJson(cmd, result)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "host: @%s\naddress: %s\nlatency: %s\nos: %s\n", result.Name, result.Address, result.Latency, result.OS)
+			return nil
+		},
+	}
+
+	testCmd.Flags().BoolVar(&testArgs.json, "json", false, "Print the output as json")
+
+	hostCmd.AddCommand(testCmd)
+}
+
+func registerHostKeygenCmd(hostCmd *cobra.Command) {
+	keygenArgs := hostOptions{}
+
+	var keygenCmd = &cobra.Command{
+		Use:   "keygen <name>",
+		Short: "generates a key for a host and uses it as the identity of the host",
+		Long:  `The keygen command generates a key for a host and uses it as the identity of the host. With --install, the public key is added to ~/.ssh/authorized_keys on the host using the current credentials.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := types.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			name := hosts.NormalizeName(args[0])
+			h, err := hosts.Get(cfg, name)
+			if err != nil {
+				return err
+			}
+
+			file := keygenArgs.file
+			if file == "" {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					return err
+				}
+
+				file = filepath.Join(home, ".ssh", "j9d_"+name)
+			}
+
+			file, err = filepath.Abs(ssh.ExpandHome(file))
+			if err != nil {
+				return err
+			}
+
+			err = os.MkdirAll(filepath.Dir(file), 0700)
+			if err != nil {
+				return err
+			}
+
+			err = ssh.GenerateSSHKey(file)
+			if err != nil {
+				return err
+			}
+
+			if keygenArgs.install {
+				pub, err := os.ReadFile(file + ".pub")
+				if err != nil {
+					return err
+				}
+
+				err = hosts.InstallKey(h, pub)
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "installed %s.pub on @%s\n", file, name)
+			}
+
+			h.Identity = file
+			cfg.Hosts[name] = h
+			err = types.SaveGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "host @%s uses %s\n", name, file)
+			return nil
+		},
+	}
+
+	keygenCmd.Flags().StringVarP(&keygenArgs.file, "file", "f", "", "The private key file. Defaults to ~/.ssh/j9d_<name>.")
+	keygenCmd.Flags().BoolVar(&keygenArgs.install, "install", false, "Add the public key to ~/.ssh/authorized_keys on the host")
+
+	hostCmd.AddCommand(keygenCmd)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func init() {
+	registerHostCmd(rootCmd)
+}
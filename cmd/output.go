@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/spf13/cobra"
+)
+
+// writeJson writes v as indented json to the command output.
+func writeJson(cmd *cobra.Command, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(data))
+	return err
+}
+
+// writeTable writes the headers and rows as an aligned table to the
+// command output.
+func writeTable(cmd *cobra.Command, headers []string, rows [][]string) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 3, ' ', 0)
+	_, err := w.Write([]byte(strings.Join(headers, "\t") + "\n"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		_, err = w.Write([]byte(strings.Join(row, "\t") + "\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// writePlan writes the deployment plan to the command output.
+func writePlan(cmd *cobra.Command, plan *deployments.Plan, asJson bool) error {
+	if asJson {
+		return writeJson(cmd, plan)
+	}
+
+	w := cmd.OutOrStdout()
+	fmt.Fprintf(w, "action: %s\ndriver: %s\nfile: %s\ntarget: %s\n", plan.Action, plan.Driver, plan.File, plan.Target)
+	if plan.Context != "" {
+		fmt.Fprintf(w, "context: %s\n", plan.Context)
+	}
+
+	writeList := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, item := range items {
+			fmt.Fprintf(w, "  %s\n", item)
+		}
+	}
+
+	writeList("files", plan.Files)
+	writeList("inherits", plan.Inherits)
+	writeList("vaults", plan.Vaults)
+	writeList("generated secrets", plan.Generated)
+
+	env := []string{}
+	for _, k := range sortedKeys(plan.Env) {
+		env = append(env, k+"="+plan.Env[k])
+	}
+
+	writeList("env", env)
+
+	hooks := []string{}
+	for _, h := range plan.Hooks {
+		run := h.Run
+		if h.Use != "exec" {
+			parts := []string{"use", h.Use}
+			for _, k := range sortedKeys(h.With) {
+				parts = append(parts, k+"="+h.With[k])
+			}
+
+			if run != "" {
+				parts = append(parts, run)
+			}
+
+			run = strings.Join(parts, " ")
+		}
+
+		hooks = append(hooks, fmt.Sprintf("[%s] %s (%s): %s", h.Stage, h.Name, h.On, run))
+	}
+
+	writeList("hooks", hooks)
+	writeList("commands", plan.Commands)
+	return nil
+}
@@ -12,6 +12,8 @@ type removeOptions struct {
 	project string
 	target  string
 	file    string
+	dryRun  bool
+	json    bool
 }
 
 func registerRemoveCmd(rootCmd *cobra.Command) {
@@ -32,6 +34,15 @@ func registerRemoveCmd(rootCmd *cobra.Command) {
 			params.Project = removeArgs.project
 			params.Target = removeArgs.target
 
+			if removeArgs.dryRun {
+				plan, err := deployments.PlanRemove(params)
+				if err != nil {
+					return err
+				}
+
+				return writePlan(cmd, plan, removeArgs.json)
+			}
+
 			return deployments.Remove(params)
 		},
 	}
@@ -40,6 +51,9 @@ func registerRemoveCmd(rootCmd *cobra.Command) {
 	removeCmd.Flags().StringVarP(&removeArgs.target, "target", "t", "", "The project target to remove. The target is generally used to specify the environment - e.g. dev, staging, prod.")
 	removeCmd.Flags().StringVarP(&removeArgs.file, "file", "f", "", "The j9d file to use to remove the deployment. Supercedes the project and target flags.")
 
+	removeCmd.Flags().BoolVar(&removeArgs.dryRun, "dry-run", false, "Print the plan without executing anything or writing to vaults")
+	removeCmd.Flags().BoolVar(&removeArgs.json, "json", false, "Print the dry run plan as json")
+
 	rootCmd.AddCommand(removeCmd)
 }
 
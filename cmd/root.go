@@ -6,11 +6,22 @@ package cmd
 
 import (
 	"os"
+	"strings"
 
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/jolt9dev/j9d/pkg/xexec"
 	"github.com/spf13/cobra"
 )
 
+type rootOptions struct {
+	verbose      bool
+	trace        bool
+	quiet        bool
+	hostKeyCheck string
+}
 
+var rootArgs = rootOptions{}
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -25,13 +36,49 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case rootArgs.quiet:
+			logs.SetLevel(logs.ErrorLevel)
+		case rootArgs.trace:
+			logs.SetLevel(logs.TraceLevel)
+		case rootArgs.verbose:
+			logs.SetLevel(logs.DebugLevel)
+		case os.Getenv("J9D_LOG_LEVEL") != "":
+			l, err := logs.ParseLevel(os.Getenv("J9D_LOG_LEVEL"))
+			if err != nil {
+				return err
+			}
+
+			logs.SetLevel(l)
+		}
+
+		xexec.SetLogger(func(c *xexec.Cmd) {
+			logs.Debugf("exec: %s", strings.Join(c.Args, " "))
+		})
+
+		if rootArgs.hostKeyCheck != "" {
+			mode, err := ssh.ParseHostKeyMode(rootArgs.hostKeyCheck)
+			if err != nil {
+				return err
+			}
+
+			ssh.SetHostKeyMode(mode)
+		}
+
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// errors are printed here instead of by cobra to mask the secrets
+	// in them.
+	rootCmd.SilenceErrors = true
 	err := rootCmd.Execute()
 	if err != nil {
+		rootCmd.PrintErrln(rootCmd.ErrPrefix(), logs.Mask(err.Error()))
 		os.Exit(1)
 	}
 }
@@ -42,6 +89,11 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.j9d.yaml)")
+	rootCmd.PersistentFlags().BoolVarP(&rootArgs.verbose, "verbose", "v", false, "Print debug messages")
+	rootCmd.PersistentFlags().BoolVar(&rootArgs.trace, "trace", false, "Print trace messages e.g. the env of commands, overrides J9D_LOG_LEVEL")
+	rootCmd.PersistentFlags().BoolVarP(&rootArgs.quiet, "quiet", "q", false, "Only print errors")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "trace", "quiet")
+	rootCmd.PersistentFlags().StringVar(&rootArgs.hostKeyCheck, "host-key-check", "", "Default ssh host key checking: strict, accept-new or off (default accept-new)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
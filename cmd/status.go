@@ -0,0 +1,60 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/spf13/cobra"
+)
+
+type statusOptions struct {
+	project string
+	target  string
+	file    string
+	json    bool
+}
+
+func registerStatusCmd(rootCmd *cobra.Command) {
+	statusArgs := statusOptions{}
+
+	// statusCmd represents the status command
+	var statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "shows the status of a deployment",
+		Long:  `The status command shows the services of a deployment and their status as reported by the deployment driver`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := deployments.StatusParams{}
+			params.File = statusArgs.file
+			params.Project = statusArgs.project
+			params.Target = statusArgs.target
+
+			status, err := deployments.GetStatus(params)
+			if err != nil {
+				return err
+			}
+
+			if statusArgs.json {
+				return writeJson(cmd, status)
+			}
+
+			rows := [][]string{}
+			for _, s := range status.Services {
+				rows = append(rows, []string{s.Name, s.Status})
+			}
+
+			return writeTable(cmd, []string{"SERVICE", "STATUS"}, rows)
+		},
+	}
+
+	statusCmd.Flags().StringVarP(&statusArgs.project, "project", "p", "", "The project to show. Projects should be in the @workspace/project format -e.g. @org/traefik.")
+	statusCmd.Flags().StringVarP(&statusArgs.target, "target", "t", "", "The project target to show - e.g. dev, staging, prod.")
+	statusCmd.Flags().StringVarP(&statusArgs.file, "file", "f", "", "The j9d file of the deployment. Supercedes the project and target flags.")
+	statusCmd.Flags().BoolVar(&statusArgs.json, "json", false, "Print the output as json")
+
+	rootCmd.AddCommand(statusCmd)
+}
+
+func init() {
+	registerStatusCmd(rootCmd)
+}
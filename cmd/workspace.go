@@ -0,0 +1,361 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/jolt9dev/j9d/pkg/workspaces"
+	"github.com/spf13/cobra"
+)
+
+type workspaceOptions struct {
+	workspace string
+	target    string
+	name      string
+	json      bool
+	dryRun    bool
+}
+
+func registerWorkspaceCmd(rootCmd *cobra.Command) {
+	// workspaceCmd represents the workspace command group
+	var workspaceCmd = &cobra.Command{
+		Use:     "workspace",
+		Aliases: []string{"ws"},
+		Short:   "manages workspaces and their projects",
+		Long:    `The workspace command manages the workspaces registered in the global config and the projects within them`,
+	}
+
+	registerWorkspaceInitCmd(workspaceCmd)
+	registerWorkspaceListCmd(workspaceCmd)
+	registerWorkspaceShowCmd(workspaceCmd)
+	registerWorkspaceAddProjectCmd(workspaceCmd)
+	registerWorkspaceRemoveProjectCmd(workspaceCmd)
+	registerWorkspaceDiscoverCmd(workspaceCmd)
+
+	rootCmd.AddCommand(workspaceCmd)
+}
+
+func registerWorkspaceInitCmd(workspaceCmd *cobra.Command) {
+	initArgs := workspaceOptions{}
+
+	var initCmd = &cobra.Command{
+		Use:   "init [dir]",
+		Short: "creates a workspace and registers it in the global config",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+
+			cfg, err := types.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			name := initArgs.name
+			if name == "" {
+				abs, err := filepath.Abs(dir)
+				if err != nil {
+					return err
+				}
+
+				name = filepath.Base(abs)
+			}
+
+			if p, ok := workspaces.FindPath(cfg, name); ok {
+				return fmt.Errorf("workspace @%s is already registered to %s", workspaces.NormalizeName(name), p)
+			}
+
+			wsf, err := workspaces.Init(dir, name)
+			if err != nil {
+				return err
+			}
+
+			err = workspaces.Register(cfg, name, wsf.File)
+			if err != nil {
+				return err
+			}
+
+			err = types.SaveGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "created workspace @%s at %s\n", wsf.Config.Name, wsf.File)
+			return nil
+		},
+	}
+
+	initCmd.Flags().StringVarP(&initArgs.name, "name", "n", "", "The name of the workspace. Defaults to the name of the directory.")
+
+	workspaceCmd.AddCommand(initCmd)
+}
+
+func registerWorkspaceListCmd(workspaceCmd *cobra.Command) {
+	listArgs := workspaceOptions{}
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "lists the workspaces registered in the global config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := types.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+
+			type workspaceItem struct {
+				Name     string `json:"name"`
+				File     string `json:"file"`
+				Projects int    `json:"projects"`
+				Exists   bool   `json:"exists"`
+			}
+
+			items := []workspaceItem{}
+			for _, name := range sortedKeys(cfg.Workspaces) {
+				item := workspaceItem{
+					Name:     workspaces.NormalizeName(name),
+					File:     cfg.Workspaces[name],
+					Projects: -1,
+				}
+
+				wsf, err := workspaces.LoadFile(item.File)
+				if err == nil {
+					item.File = wsf.File
+					item.Exists = true
+					item.Projects = len(wsf.Config.Projects)
+				}
+
+				items = append(items, item)
+			}
+
+			if listArgs.json {
+				return writeJson(cmd, items)
+			}
+
+			rows := [][]string{}
+			for _, item := range items {
+				projects := "-"
+				if item.Exists {
+					projects = fmt.Sprintf("%d", item.Projects)
+				}
+
+				rows = append(rows, []string{"@" + item.Name, projects, item.File})
+			}
+
+			return writeTable(cmd, []string{"NAME", "PROJECTS", "FILE"}, rows)
+		},
+	}
+
+	listCmd.Flags().BoolVar(&listArgs.json, "json", false, "Print the output as json")
+
+	workspaceCmd.AddCommand(listCmd)
+}
+
+func registerWorkspaceShowCmd(workspaceCmd *cobra.Command) {
+	showArgs := workspaceOptions{}
+
+	var showCmd = &cobra.Command{
+		Use:   "show [workspace]",
+		Short: "shows the projects and targets of a workspace",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := workspaces.DefaultWorkspace
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			wsf, err := workspaces.Load(name)
+			if err != nil {
+				return err
+			}
+
+			type targetItem struct {
+				Project string `json:"project"`
+				Target  string `json:"target"`
+				File    string `json:"file"`
+				Exists  bool   `json:"exists"`
+			}
+
+			items := []targetItem{}
+			for _, project := range sortedKeys(wsf.Config.Projects) {
+				p := wsf.Config.Projects[project]
+				for _, target := range sortedKeys(p.Targets) {
+					item := targetItem{
+						Project: project,
+						Target:  target,
+						File:    p.Targets[target],
+					}
+
+					_, err := workspaces.ResolveFile(wsf, project, target)
+					item.Exists = err == nil
+					items = append(items, item)
+				}
+			}
+
+			if showArgs.json {
+				return writeJson(cmd, map[string]interface{}{
+					"name":    wsf.Config.Name,
+					"file":    wsf.File,
+					"targets": items,
+				})
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "workspace: @%s\nfile: %s\n\n", workspaces.NormalizeName(wsf.Config.Name), wsf.File)
+
+			rows := [][]string{}
+			for _, item := range items {
+				status := "ok"
+				if !item.Exists {
+					status = "missing"
+				}
+
+				rows = append(rows, []string{item.Project, item.Target, status, item.File})
+			}
+
+			return writeTable(cmd, []string{"PROJECT", "TARGET", "STATUS", "FILE"}, rows)
+		},
+	}
+
+	showCmd.Flags().BoolVar(&showArgs.json, "json", false, "Print the output as json")
+
+	workspaceCmd.AddCommand(showCmd)
+}
+
+func registerWorkspaceAddProjectCmd(workspaceCmd *cobra.Command) {
+	addArgs := workspaceOptions{}
+
+	var addCmd = &cobra.Command{
+		Use:   "add-project <project> <path>",
+		Short: "adds a project target to a workspace",
+		Long:  `The add-project command adds a project target to a workspace. The path must be a j9d file or a directory with a j9d.yaml file.`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			wsf, err := workspaces.Load(addArgs.workspace)
+			if err != nil {
+				return err
+			}
+
+			err = workspaces.AddProject(wsf, args[0], addArgs.target, args[1])
+			if err != nil {
+				return err
+			}
+
+			err = wsf.Save()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "added @%s/%s\n", workspaces.NormalizeName(wsf.Config.Name), args[0])
+			return nil
+		},
+	}
+
+	addCmd.Flags().StringVarP(&addArgs.workspace, "workspace", "w", workspaces.DefaultWorkspace, "The workspace to add the project to")
+	addCmd.Flags().StringVarP(&addArgs.target, "target", "t", workspaces.DefaultTarget, "The project target the path is used for - e.g. dev, staging, prod.")
+
+	workspaceCmd.AddCommand(addCmd)
+}
+
+func registerWorkspaceRemoveProjectCmd(workspaceCmd *cobra.Command) {
+	removeArgs := workspaceOptions{}
+
+	var removeCmd = &cobra.Command{
+		Use:   "remove-project <project>",
+		Short: "removes a project or a single project target from a workspace",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			wsf, err := workspaces.Load(removeArgs.workspace)
+			if err != nil {
+				return err
+			}
+
+			err = workspaces.RemoveProject(wsf, args[0], removeArgs.target)
+			if err != nil {
+				return err
+			}
+
+			err = wsf.Save()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "removed @%s/%s\n", workspaces.NormalizeName(wsf.Config.Name), args[0])
+			return nil
+		},
+	}
+
+	removeCmd.Flags().StringVarP(&removeArgs.workspace, "workspace", "w", workspaces.DefaultWorkspace, "The workspace to remove the project from")
+	removeCmd.Flags().StringVarP(&removeArgs.target, "target", "t", "", "Only remove the given project target")
+
+	workspaceCmd.AddCommand(removeCmd)
+}
+
+func registerWorkspaceDiscoverCmd(workspaceCmd *cobra.Command) {
+	discoverArgs := workspaceOptions{}
+
+	var discoverCmd = &cobra.Command{
+		Use:   "discover [workspace]",
+		Short: "discovers projects using the workspace include and exclude globs",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := workspaces.DefaultWorkspace
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			wsf, err := workspaces.Load(name)
+			if err != nil {
+				return err
+			}
+
+			if wsf.Config.Discovery == nil {
+				return fmt.Errorf("workspace @%s has no discovery block", workspaces.NormalizeName(wsf.Config.Name))
+			}
+
+			found, err := workspaces.Discover(wsf, &workspaces.DiscoverOptions{Save: !discoverArgs.dryRun})
+			if err != nil {
+				return err
+			}
+
+			if discoverArgs.json {
+				return writeJson(cmd, found)
+			}
+
+			rows := [][]string{}
+			for _, project := range sortedKeys(found) {
+				p := found[project]
+				for _, target := range sortedKeys(p.Targets) {
+					rows = append(rows, []string{project, target, p.Targets[target]})
+				}
+			}
+
+			return writeTable(cmd, []string{"PROJECT", "TARGET", "FILE"}, rows)
+		},
+	}
+
+	discoverCmd.Flags().BoolVar(&discoverArgs.json, "json", false, "Print the output as json")
+	discoverCmd.Flags().BoolVar(&discoverArgs.dryRun, "dry-run", false, "Print the discovered projects without saving the workspace file")
+
+	workspaceCmd.AddCommand(discoverCmd)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func init() {
+	registerWorkspaceCmd(rootCmd)
+}
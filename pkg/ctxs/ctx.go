@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"net/url"
 	"path/filepath"
+	"strings"
 
 	"github.com/jolt9dev/j9d/pkg/env"
+	"github.com/jolt9dev/j9d/pkg/logs"
 	"github.com/jolt9dev/j9d/pkg/types"
 	"github.com/jolt9dev/j9d/pkg/vaults"
+	"github.com/jolt9dev/j9d/pkg/vaults/hcvault"
 	"github.com/jolt9dev/j9d/pkg/vaults/sops"
 	fs "github.com/jolt9dev/j9d/pkg/xfs"
 	"github.com/m1/go-generate-password/generator"
@@ -19,9 +22,44 @@ type ExecContext struct {
 	Secrets map[string]string
 	Jolt9   *types.Jolt9
 	Cwd     string
+	Target  string
+
+	// File is the j9d file that was loaded and Files are the j9d
+	// files merged for the target in order.
+	File  string
+	Files []string
+
+	// Inherits are the files inherited by the j9d files.
+	Inherits []string
+
+	// Vaults are the names of the vaults used to load secrets.
+	Vaults []string
+
+	// Generated are the names of the secrets that were generated
+	// because they were not found in a vault.
+	Generated []string
+}
+
+type LoadParams struct {
+	File      string
+	Target    string
+	Workspace *types.WorkspaceFile
+
+	// DryRun skips writing generated secrets to vaults.
+	DryRun bool
 }
 
 func Load(file string) (*ExecContext, error) {
+	return LoadWithParams(LoadParams{File: file})
+}
+
+// LoadWithParams loads the j9d file for the target and applies the
+// vaults, secrets and dns entries of the workspace the project was
+// loaded through. The j9d.yaml file is used as the base and the
+// <target>.j9d.yaml file is merged on top of it.
+func LoadWithParams(params LoadParams) (*ExecContext, error) {
+	file := params.File
+	wsf := params.Workspace
 	if !fs.Exists(file) {
 		return nil, fmt.Errorf("file %s not found", file)
 	}
@@ -32,22 +70,48 @@ func Load(file string) (*ExecContext, error) {
 	vars := make(map[string]string)
 	secrets := make(map[string]string)
 
-	bytes, err := fs.ReadFile(file)
+	// workspaces map targets to files explicitly, so the target
+	// override is optional for projects loaded through a workspace.
+	target, files, err := targetFiles(file, params.Target, wsf != nil)
 	if err != nil {
 		return nil, err
 	}
 
-	jolt9 := &types.Jolt9{}
-	err = yaml.Unmarshal(bytes, jolt9)
-	if err != nil {
-		return nil, err
+	var jolt9 *types.Jolt9
+	inherits := []string{}
+	for _, f := range files {
+		next, inherited, err := loadJolt9(f)
+		if err != nil {
+			return nil, err
+		}
+
+		inherits = append(inherits, inherited...)
+
+		if jolt9 == nil {
+			jolt9 = next
+			continue
+		}
+
+		jolt9.Merge(next)
 	}
 
-	dir := filepath.Dir(file)
+	env.Set("J9D_TARGET", target)
+	vars["J9D_TARGET"] = target
 
-	jolt9, err = jolt9.ResolveInheritence(dir)
-	if err != nil {
-		return nil, err
+	// workspace vaults are resolved relative to the workspace directory
+	// unless the project declares a vault with the same name.
+	vaultDirs := make(map[string]string)
+	if wsf != nil && wsf.Config != nil {
+		wsDir := filepath.Dir(wsf.File)
+		for _, v := range wsf.Config.Vaults {
+			vaultDirs[v.Name] = wsDir
+		}
+
+		for _, v := range jolt9.Vaults {
+			delete(vaultDirs, v.Name)
+		}
+
+		jolt9.ApplyWorkspace(wsf.Config)
 	}
 
 	if len(jolt9.Secrets) > 0 && len(jolt9.Vaults) == 0 {
@@ -63,9 +127,22 @@ func Load(file string) (*ExecContext, error) {
 				return nil, err
 			}
 
+			cwd, ok := vaultDirs[vault.Name]
+			if !ok {
+				cwd = workingDir
+			}
+
 			switch u.Scheme {
 			case "sops":
-				v, err := loadSopsVault(&vault, workingDir)
+				v, err := loadSopsVault(&vault, cwd)
+				if err != nil {
+					return nil, err
+				}
+
+				vaults[vault.Name] = v
+
+			case "vault", "hcv":
+				v, err := loadHcVault(&vault, cwd)
 				if err != nil {
 					return nil, err
 				}
@@ -79,6 +156,12 @@ func Load(file string) (*ExecContext, error) {
 	}
 
 	vaultCount := len(vaults)
+	vaultNames := []string{}
+	for _, v := range jolt9.Vaults {
+		vaultNames = append(vaultNames, v.Name)
+	}
+
+	generated := []string{}
 
 	for _, s := range jolt9.Secrets {
 		if s.Key == "" {
@@ -156,22 +239,26 @@ func Load(file string) (*ExecContext, error) {
 				}
 
 				secretValue = *v2
-
-				if vaultCount == 1 {
-					for _, vt := range vaults {
-						err = vt.SetSecretValue(s.Key, secretValue, nil)
-						if err != nil {
-							return nil, err
+				generated = append(generated, s.Name)
+
+				// generated secrets are not persisted in a dry run.
+				if !params.DryRun {
+					if vaultCount == 1 {
+						for _, vt := range vaults {
+							err = vt.SetSecretValue(s.Key, secretValue, nil)
+							if err != nil {
+								return nil, err
+							}
+
+							break
 						}
-
-						break
-					}
-				} else {
-					vt, ok := vaults[s.Vault]
-					if ok {
-						err = vt.SetSecretValue(s.Key, secretValue, nil)
-						if err != nil {
-							return nil, err
+					} else {
+						vt, ok := vaults[s.Vault]
+						if ok {
+							err = vt.SetSecretValue(s.Key, secretValue, nil)
+							if err != nil {
+								return nil, err
+							}
 						}
 					}
 				}
@@ -180,6 +267,7 @@ func Load(file string) (*ExecContext, error) {
 			}
 		}
 
+		logs.AddSecret(secretValue)
 		secrets[s.Name] = secretValue
 		env.Set(s.Name, secretValue)
 		vars[s.Name] = secretValue
@@ -198,14 +286,105 @@ func Load(file string) (*ExecContext, error) {
 	}
 
 	return &ExecContext{
-		Env:     vars,
-		Secrets: secrets,
-		Jolt9:   jolt9,
-		Cwd:     workingDir,
+		Env:       vars,
+		Secrets:   secrets,
+		Jolt9:     jolt9,
+		Cwd:       workingDir,
+		Target:    target,
+		File:      file,
+		Files:     files,
+		Inherits:  inherits,
+		Vaults:    vaultNames,
+		Generated: generated,
 	}, nil
 }
 
-func loadSopsVault(vault *types.Vault, cwd string) (*sops.SopsCliSecretVault, error) {
+// loadJolt9 loads the j9d file with its inherited files merged in and
+// returns the inherited files.
+func loadJolt9(file string) (*types.Jolt9, []string, error) {
+	bytes, err := fs.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jolt9 := &types.Jolt9{}
+	err = yaml.Unmarshal(bytes, jolt9)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir := filepath.Dir(file)
+	inherits := []string{}
+	for _, inherit := range jolt9.Inherits {
+		if inherit == "" {
+			continue
+		}
+
+		next, err := fs.Resolve(inherit, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		inherits = append(inherits, next)
+	}
+
+	jolt9, err = jolt9.ResolveInheritence(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return jolt9, inherits, nil
+}
+
+// targetFiles returns the target and the j9d files to merge in order.
+// When file is a <target>.j9d.yaml file, the j9d.yaml file in the same
+// directory is used as the base and the target defaults to the one in
+// the file name. Both .yaml and .yml files are used. Unless optional is
+// set, an error is returned when the <target>.j9d.yaml file for the
+// target does not exist.
+func targetFiles(file, target string, optional bool) (string, []string, error) {
+	dir := filepath.Dir(file)
+	name := filepath.Base(file)
+	isBase := name == "j9d.yaml" || name == "j9d.yml"
+
+	if base, ok := types.FindTargetFile(dir, ""); ok && !isBase {
+		for _, ext := range []string{".j9d.yaml", ".j9d.yml"} {
+			if !strings.HasSuffix(name, ext) {
+				continue
+			}
+
+			if target == "" {
+				target = strings.TrimSuffix(name, ext)
+			}
+
+			return target, []string{base, file}, nil
+		}
+	}
+
+	if target == "" || target == "default" {
+		return "default", []string{file}, nil
+	}
+
+	if !isBase {
+		return target, []string{file}, nil
+	}
+
+	overlay, ok := types.FindTargetFile(dir, target)
+	if !ok {
+		if optional {
+			return target, []string{file}, nil
+		}
+
+		return "", nil, fmt.Errorf("j9d file %s not found for target %s", overlay, target)
+	}
+
+	return target, []string{file, overlay}, nil
+}
+
+// loadSopsVault creates the sops vault of the vault uri. The native
+// engine is used for age keys unless engine=cli is set or the file is an
+// ini file, other drivers shell out to sops.
+func loadSopsVault(vault *types.Vault, cwd string) (vaults.SecretVault, error) {
 	u, err := url.Parse(vault.Uri)
 	if err != nil {
 		return nil, err
@@ -216,49 +395,73 @@ func loadSopsVault(vault *types.Vault, cwd string) (*sops.SopsCliSecretVault, er
 		sopsFile = u.Host + sopsFile
 	}
 
+	if sopsFile == "" {
+		sopsFile = vaultParam(u, vault, "file")
+	}
+
+	if sopsFile == "" {
+		return nil, fmt.Errorf("sops file not found")
+	}
+
 	sopsFile, err = fs.Resolve(sopsFile, cwd)
 	if err != nil {
 		return nil, err
 	}
-	println(sopsFile)
-	recipients := u.Query().Get("age-recipients")
-	sopsKeyFile := u.Query().Get("age-key-file")
-	configFile := u.Query().Get("config")
+	logs.Debugf("using sops vault %s with file %s", vault.Name, sopsFile)
 
-	if recipients == "" {
-		v, ok := vault.With["age-recipients"]
-		if ok && v != nil {
-			recipients = v.(string)
-		}
-	}
+	recipients := vaultParam(u, vault, "age-recipients")
+	sopsKeyFile := vaultParam(u, vault, "age-key-file")
+	configFile := vaultParam(u, vault, "config")
+	fileType := vaultParam(u, vault, "file-type")
+	engine := vaultParam(u, vault, "engine")
 
-	if recipients == "" {
-		recipients = env.Get("SOPS_AGE_RECIPIENTS")
+	params := &sops.SopsSecretVaultParams{
+		File:            sopsFile,
+		ConfigFile:      configFile,
+		FileType:        fileType,
+		Driver:          vaultParam(u, vault, "driver"),
+		KmsArns:         vaultParam(u, vault, "kms"),
+		GcpKmsUri:       vaultParam(u, vault, "gcp-kms"),
+		AzureKvUri:      vaultParam(u, vault, "azure-kv"),
+		VaultUri:        vaultParam(u, vault, "hc-vault-transit"),
+		PgpFingerprints: vaultParam(u, vault, "pgp"),
 	}
 
-	if sopsKeyFile == "" {
-		v, ok := vault.With["age-key-file"]
-		if ok && v != nil {
-			sopsKeyFile = v.(string)
+	awsProfile := vaultParam(u, vault, "aws-profile")
+	encryptionContext := vaultParam(u, vault, "encryption-context")
+	if params.KmsArns != "" || awsProfile != "" || encryptionContext != "" {
+		params.Kms = &sops.SopsKmsParams{
+			Uri:               params.KmsArns,
+			AwsProfile:        awsProfile,
+			EncryptionContext: encryptionContext,
 		}
 	}
 
-	if sopsFile == "" {
-		v, ok := vault.With["file"]
-		if ok && v != nil {
-			sopsFile = v.(string)
+	// the driver defaults to the first key that is configured.
+	if params.Driver == "" {
+		switch {
+		case recipients != "" || sopsKeyFile != "":
+			params.Driver = "age"
+		case params.Kms != nil:
+			params.Driver = "kms"
+		case params.GcpKmsUri != "":
+			params.Driver = "gcp-kms"
+		case params.AzureKvUri != "":
+			params.Driver = "azure-kv"
+		case params.VaultUri != "":
+			params.Driver = "hc-vault-transit"
+		case params.PgpFingerprints != "":
+			params.Driver = "pgp"
 		}
 	}
 
-	if configFile == "" {
-		v, ok := vault.With["config"]
-		if ok && v != nil {
-			configFile = v.(string)
-		}
+	params.Driver, err = sops.DriverName(params.Driver)
+	if err != nil {
+		return nil, err
 	}
 
-	if sopsFile == "" {
-		return nil, fmt.Errorf("sops file not found")
+	if params.Driver == "age" && recipients == "" {
+		recipients = env.Get("SOPS_AGE_RECIPIENTS")
 	}
 
 	if sopsKeyFile != "" {
@@ -267,21 +470,148 @@ func loadSopsVault(vault *types.Vault, cwd string) (*sops.SopsCliSecretVault, er
 			return nil, err
 		}
 
+		sopsKeyFile = n
 		env.Set("SOPS_AGE_KEY_FILE", n)
 	}
 
-	params := &sops.SopsSecretVaultParams{
-		File:       sopsFile,
-		ConfigFile: configFile,
-	}
-
-	if recipients != "" {
-		params.Driver = "age"
+	if recipients != "" || sopsKeyFile != "" {
 		params.Age = &sops.SopsAgeParams{
 			Recipients: recipients,
 			KeyFile:    sopsKeyFile,
 		}
 	}
 
-	return sops.New(*params), nil
+	if engine == "" {
+		engine = "native"
+		if params.Driver != "age" || fileType == sops.FileTypeIni || (fileType == "" && sops.DetectFileType(sopsFile) == sops.FileTypeIni) {
+			engine = "cli"
+		}
+	}
+
+	switch engine {
+	case "native":
+		if params.Driver != "age" {
+			return nil, fmt.Errorf("the native sops engine only supports age, use engine=cli for vault %s", vault.Name)
+		}
+
+		return sops.NewNative(*params), nil
+	case "cli":
+		return sops.New(*params), nil
+	}
+
+	return nil, fmt.Errorf("unsupported sops engine %s for vault %s", engine, vault.Name)
+}
+
+// loadHcVault creates the HashiCorp Vault kv v2 vault of the vault uri
+// e.g. vault://vault.example.com:8200/secret/apps/web. The first segment
+// of the path is the mount unless mount is set. Files of the jwt-file,
+// secret-id-file and token-file params are resolved from cwd.
+func loadHcVault(vault *types.Vault, cwd string) (vaults.SecretVault, error) {
+	u, err := url.Parse(vault.Uri)
+	if err != nil {
+		return nil, err
+	}
+
+	address := vaultParam(u, vault, "address")
+	if address == "" && u.Host != "" {
+		scheme := "https"
+		if vaultParam(u, vault, "tls") == "false" {
+			scheme = "http"
+		}
+
+		address = scheme + "://" + u.Host
+	}
+
+	if address == "" {
+		address = env.Get("VAULT_ADDR")
+	}
+
+	if address == "" {
+		return nil, fmt.Errorf("no address found for vault %s", vault.Name)
+	}
+
+	path := strings.Trim(u.Path, "/")
+	mount := vaultParam(u, vault, "mount")
+	if mount == "" {
+		mount, path, _ = strings.Cut(path, "/")
+	}
+
+	if p := vaultParam(u, vault, "path"); p != "" {
+		path = p
+	}
+
+	namespace := vaultParam(u, vault, "namespace")
+	if namespace == "" {
+		namespace = env.Get("VAULT_NAMESPACE")
+	}
+
+	auth := &hcvault.HcVaultAuthParams{
+		Method:   vaultParam(u, vault, "auth"),
+		Mount:    vaultParam(u, vault, "auth-mount"),
+		Token:    vaultParam(u, vault, "token"),
+		RoleId:   vaultParam(u, vault, "role-id"),
+		SecretId: vaultParam(u, vault, "secret-id"),
+		Role:     vaultParam(u, vault, "role"),
+		Jwt:      vaultParam(u, vault, "jwt"),
+	}
+
+	files := map[string]*string{
+		"token-file":     &auth.Token,
+		"secret-id-file": &auth.SecretId,
+		"jwt-file":       &auth.Jwt,
+	}
+
+	for name, value := range files {
+		file := vaultParam(u, vault, name)
+		if file == "" || *value != "" {
+			continue
+		}
+
+		file, err = fs.Resolve(file, cwd)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := fs.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		*value = strings.TrimSpace(string(data))
+	}
+
+	if auth.Method == "" {
+		switch {
+		case auth.RoleId != "":
+			auth.Method = "approle"
+		case auth.Jwt != "":
+			auth.Method = "jwt"
+		default:
+			auth.Method = "token"
+		}
+	}
+
+	logs.Debugf("using vault %s with %s/%s", vault.Name, address, strings.Trim(mount+"/"+path, "/"))
+
+	return hcvault.New(hcvault.HcVaultSecretVaultParams{
+		Address:   address,
+		Namespace: namespace,
+		Mount:     mount,
+		Path:      path,
+		Auth:      auth,
+	}), nil
+}
+
+// vaultParam returns the query parameter of the vault uri or the value
+// of the vault with block.
+func vaultParam(u *url.URL, vault *types.Vault, name string) string {
+	if v := u.Query().Get(name); v != "" {
+		return v
+	}
+
+	if v, ok := vault.With[name]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+
+	return ""
 }
@@ -0,0 +1,101 @@
+package ctxs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadWithTarget(t *testing.T) {
+	dir := t.TempDir()
+	base := `name: whoami
+env:
+  REPLICAS: "1"
+  HOST: whoami.dev.example.com
+compose:
+  include:
+    - compose.yaml
+`
+	prod := `env:
+  REPLICAS: "3"
+  HOST: whoami.example.com
+  STACK: "${J9D_TARGET}-whoami"
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "j9d.yaml"), []byte(base), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "prod.j9d.yaml"), []byte(prod), 0644))
+
+	ctx, err := ctxs.LoadWithParams(ctxs.LoadParams{File: filepath.Join(dir, "j9d.yaml"), Target: "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", ctx.Target)
+	assert.Equal(t, "whoami", ctx.Jolt9.Name)
+	assert.Equal(t, []string{"compose.yaml"}, ctx.Jolt9.Compose.Include)
+	assert.Equal(t, "3", ctx.Env["REPLICAS"])
+	assert.Equal(t, "prod", ctx.Env["J9D_TARGET"])
+	assert.Equal(t, "prod-whoami", ctx.Env["STACK"])
+	assert.Len(t, ctx.Files, 2)
+
+	ctx, err = ctxs.Load(filepath.Join(dir, "prod.j9d.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", ctx.Target)
+	assert.Equal(t, "whoami", ctx.Jolt9.Name)
+
+	ctx, err = ctxs.Load(filepath.Join(dir, "j9d.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "default", ctx.Target)
+	assert.Equal(t, "1", ctx.Env["REPLICAS"])
+
+	_, err = ctxs.LoadWithParams(ctxs.LoadParams{File: filepath.Join(dir, "j9d.yaml"), Target: "staging"})
+	assert.Error(t, err)
+}
+
+func TestLoadWithTargetYml(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "j9d.yml"), []byte("name: whoami\nenv:\n  REPLICAS: \"1\"\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "prod.j9d.yml"), []byte("env:\n  REPLICAS: \"3\"\n"), 0644))
+
+	ctx, err := ctxs.LoadWithParams(ctxs.LoadParams{File: filepath.Join(dir, "j9d.yml"), Target: "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", ctx.Target)
+	assert.Equal(t, "3", ctx.Env["REPLICAS"])
+
+	ctx, err = ctxs.Load(filepath.Join(dir, "prod.j9d.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", ctx.Target)
+	assert.Equal(t, "whoami", ctx.Jolt9.Name)
+	assert.Equal(t, "3", ctx.Env["REPLICAS"])
+}
+
+func TestLoadHcVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/data/apps/web" || r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte(`{"data":{"data":{"DB_PASSWORD":"s3cr3t"},"metadata":{"version":1}}}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	content := `name: web
+vaults:
+  - name: prod
+    uri: vault://` + strings.TrimPrefix(srv.URL, "http://") + `/kv/apps/web?tls=false
+    with:
+      token-file: ./token
+secrets:
+  - name: DB_PASSWORD
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "j9d.yaml"), []byte(content), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("root\n"), 0600))
+
+	ctx, err := ctxs.Load(filepath.Join(dir, "j9d.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", ctx.Secrets["DB_PASSWORD"])
+}
@@ -0,0 +1,156 @@
+package deployments
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/types"
+	exec "github.com/jolt9dev/j9d/pkg/xexec"
+)
+
+// composeDriver deploys the compose block with docker compose.
+type composeDriver struct{}
+
+func (d *composeDriver) Name() string {
+	return "compose"
+}
+
+func (d *composeDriver) Detect(j9d *types.Jolt9) bool {
+	return j9d.Compose != nil
+}
+
+func (d *composeDriver) Validate(ctx *ctxs.ExecContext) error {
+	return validateCompose(ctx)
+}
+
+func (d *composeDriver) Plan(ctx *ctxs.ExecContext, action string, plan *Plan) error {
+	return planCompose(ctx, action, plan, d.args)
+}
+
+func (d *composeDriver) Deploy(ctx *ctxs.ExecContext) error {
+	return runCompose(ctx, ActionDeploy, d.args)
+}
+
+func (d *composeDriver) Remove(ctx *ctxs.ExecContext) error {
+	return runCompose(ctx, ActionRemove, d.args)
+}
+
+func (d *composeDriver) Status(ctx *ctxs.ExecContext) (*Status, error) {
+	j9d := ctx.Jolt9
+	proc, args := dockerCommand(j9d, []string{
+		"--context", composeContext(j9d),
+		"compose", "--project-name", j9d.Name,
+		"ps", "--all", "--format", "{{.Service}}\t{{.State}}",
+	})
+
+	return dockerStatus(ctx, d.Name(), proc, args)
+}
+
+func (d *composeDriver) args(ctx *ctxs.ExecContext, files []string, action string) []string {
+	args := []string{"compose", "--project-name", ctx.Jolt9.Name}
+	for _, f := range files {
+		args = append(args, "-f", f)
+	}
+
+	if action == ActionRemove {
+		return append(args, "down")
+	}
+
+	return append(args, "up", "-d")
+}
+
+// composeArgs returns the docker arguments after the context for the
+// compose files and action.
+type composeArgs func(ctx *ctxs.ExecContext, files []string, action string) []string
+
+func validateCompose(ctx *ctxs.ExecContext) error {
+	j9d := ctx.Jolt9
+	if j9d.Name == "" {
+		return fmt.Errorf("name is required for compose deployments")
+	}
+
+	if len(j9d.Compose.Include) == 0 && strings.TrimSpace(j9d.Compose.Inline) == "" {
+		return fmt.Errorf("compose block of %s has no include files or inline definition", j9d.Name)
+	}
+
+	return nil
+}
+
+func planCompose(ctx *ctxs.ExecContext, action string, plan *Plan, build composeArgs) error {
+	j9d := ctx.Jolt9
+	plan.Context = composeContext(j9d)
+
+	files, _, err := composeFiles(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(j9d.Compose.Inline) != "" {
+		inline, err := expandInline(ctx)
+		if err != nil {
+			return err
+		}
+
+		plan.Inline = redact(ctx, "", inline)
+	}
+
+	args := append([]string{"--context", plan.Context}, build(ctx, files, action)...)
+	proc, args := dockerCommand(j9d, args)
+	plan.Commands = append(plan.Commands, proc+" "+strings.Join(args, " "))
+	return nil
+}
+
+func runCompose(ctx *ctxs.ExecContext, action string, build composeArgs) error {
+	context := composeContext(ctx.Jolt9)
+	if context != "default" {
+		err := ensureContext(context, ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	files, cleanup, err := composeFiles(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	args := append([]string{"--context", context}, build(ctx, files, action)...)
+	proc, args := dockerCommand(ctx.Jolt9, args)
+	return runDocker(ctx, proc, args)
+}
+
+// dockerStatus runs a docker command that prints a service and its
+// status separated by a tab per line.
+func dockerStatus(ctx *ctxs.ExecContext, driver, proc string, args []string) (*Status, error) {
+	cmd := exec.New(proc, args...)
+	cmd.WithEnvMap(ctx.Env)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Code != 0 {
+		return nil, fmt.Errorf("docker %s failed: %s", strings.Join(args, " "), out.ErrorText())
+	}
+
+	status := &Status{
+		Driver:   driver,
+		Name:     ctx.Jolt9.Name,
+		Services: []ServiceStatus{},
+	}
+
+	for _, line := range out.Lines() {
+		parts := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		status.Services = append(status.Services, ServiceStatus{Name: parts[0], Status: parts[1]})
+	}
+
+	return status, nil
+}
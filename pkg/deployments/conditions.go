@@ -0,0 +1,100 @@
+package deployments
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/env"
+	"github.com/jolt9dev/j9d/pkg/xstrings"
+)
+
+// evalCondition evaluates the if condition of a task. A condition is
+// clauses joined by && and || where a clause is a value, !value,
+// a == b or a != b. Values are expanded with the env and a value is
+// true unless it is empty, 0, false, no or off.
+func evalCondition(cond string, envOptions *env.ExpandOptions) (bool, error) {
+	if strings.TrimSpace(cond) == "" {
+		return false, fmt.Errorf("empty condition")
+	}
+
+	for _, or := range strings.Split(cond, "||") {
+		all := true
+		for _, clause := range strings.Split(or, "&&") {
+			ok, err := evalClause(clause, envOptions)
+			if err != nil {
+				return false, err
+			}
+
+			if !ok {
+				all = false
+				break
+			}
+		}
+
+		if all {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func evalClause(clause string, envOptions *env.ExpandOptions) (bool, error) {
+	clause = strings.TrimSpace(clause)
+	if clause == "" {
+		return false, fmt.Errorf("empty clause")
+	}
+
+	for _, op := range []string{"!=", "=="} {
+		i := strings.Index(clause, op)
+		if i < 0 {
+			continue
+		}
+
+		left, err := conditionValue(clause[:i], envOptions)
+		if err != nil {
+			return false, err
+		}
+
+		right, err := conditionValue(clause[i+2:], envOptions)
+		if err != nil {
+			return false, err
+		}
+
+		return (left == right) == (op == "=="), nil
+	}
+
+	if strings.HasPrefix(clause, "!") {
+		ok, err := evalClause(clause[1:], envOptions)
+		return !ok, err
+	}
+
+	value, err := conditionValue(clause, envOptions)
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no", "off":
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// conditionValue unquotes the value and expands it with the env.
+func conditionValue(value string, envOptions *env.ExpandOptions) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > 1 {
+		first, last := value[0], value[len(value)-1]
+		if (first == '"' || first == '\'') && first == last {
+			value = value[1 : len(value)-1]
+		}
+	}
+
+	if !xstrings.Contains(value, "$") {
+		return value, nil
+	}
+
+	return env.Expand(value, envOptions)
+}
@@ -1,16 +1,16 @@
 package deployments
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
-	"slices"
 	"strings"
 
 	"github.com/jolt9dev/j9d/pkg/cps"
 	"github.com/jolt9dev/j9d/pkg/ctxs"
-	"github.com/jolt9dev/j9d/pkg/env"
-	"github.com/jolt9dev/j9d/pkg/platform"
-	exec "github.com/jolt9dev/j9d/pkg/xexec"
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/jolt9dev/j9d/pkg/workspaces"
 	fs "github.com/jolt9dev/j9d/pkg/xfs"
 	"github.com/jolt9dev/j9d/pkg/xstrings"
 )
@@ -26,401 +26,296 @@ type DeployParams struct {
 	CommonDeploymentParams
 }
 
-func Deploy(params DeployParams) error {
+type RemoveParams struct {
+	CommonDeploymentParams
+}
 
-	file, err := getFile(params.CommonDeploymentParams)
-	if err != nil {
-		return err
-	}
+type StatusParams struct {
+	CommonDeploymentParams
+}
 
-	ctx, err := ctxs.Load(file)
+func Deploy(params DeployParams) error {
+	ctx, err := load(params.CommonDeploymentParams, false)
 	if err != nil {
 		return err
 	}
 
-	j9d := ctx.Jolt9
+	return run(ctx, ActionDeploy)
+}
 
-	if j9d.Compose != nil {
-		err = deployCompose(ctx)
-		if err != nil {
-			return err
-		}
+func Remove(params RemoveParams) error {
+	ctx, err := load(params.CommonDeploymentParams, false)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return run(ctx, ActionRemove)
 }
 
-func getFile(params CommonDeploymentParams) (string, error) {
-	cwd, err := cps.Cwd()
+// GetStatus returns the status of the deployment reported by its driver.
+func GetStatus(params StatusParams) (*Status, error) {
+	ctx, err := load(params.CommonDeploymentParams, true)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if params.Project == "" && params.File == "" {
-		return filepath.Join(cwd, "j9d.yaml"), nil
+	d, err := FindDriver(ctx.Jolt9)
+	if err != nil {
+		return nil, err
 	}
 
-	if params.Project != "" {
-		if xstrings.Contains(params.Project, "/") {
-			parts := strings.Split(params.Project, "/")
-			if len(parts) == 2 {
-				// special project handling for local projects
-				// e.g. @cwd/project -> ./project/j9d.yaml
-				// j9d deploy -p @cwd/project -t dev => ./project/dev.j9d.yaml
-				if parts[0] == "." || parts[0] == "@cwd" {
-					if params.Target != "" {
-						f := fmt.Sprintf("%s.jd9.yaml", params.Target)
-						return fs.Resolve(filepath.Join(parts[1], f), cwd)
-					}
-
-					return fs.Resolve(filepath.Join(parts[1], "j9d.yaml"), cwd)
-				} else {
-					return "", fmt.Errorf("workspaces are not supported yet")
-				}
-			}
-		} else {
-			return "", fmt.Errorf("default workspaces are not supported yet")
-		}
+	return d.Status(ctx)
+}
 
+// run runs the action with the driver of the j9d file and the hooks
+// before and after it. When the action fails, the on-failure hooks run,
+// a failed deploy of the driver is rolled back when the compose block
+// has rollback and the after-failure hooks run. The always hooks run last.
+func run(ctx *ctxs.ExecContext, action string) error {
+	d, err := FindDriver(ctx.Jolt9)
+	if err != nil {
+		return err
 	}
 
-	if params.File != "" {
-		if params.File == "." {
-			return fs.Resolve("j9d.yaml", cwd)
-		}
+	err = d.Validate(ctx)
+	if err != nil {
+		return err
+	}
 
-		// handle the case where you're in a root folder of many projects
-		// and you simply want to deploy the project using the subfolder name
-		// e.g.  j9d deploy -f myproject
-		if !filepath.IsAbs(params.File) {
-			ext := filepath.Ext(params.File)
-			if ext == "" {
-				base := filepath.Base(params.File)
-				if !strings.HasSuffix(base, "j9d") {
-					return fs.Resolve(filepath.Join(params.File, "j9d.yaml"), cwd)
-				} else {
-					return fs.Resolve(params.File+".yaml", cwd)
-				}
+	err = runAction(ctx, d, action)
+	if err == nil && action == ActionDeploy && rollbackEnabled(ctx) {
+		if r, ok := d.(Rollbacker); ok {
+			serr := r.Snapshot(ctx)
+			if serr != nil {
+				logs.Warnf("unable to save the deploy of %s for rollbacks: %s", ctx.Jolt9.Name, serr)
 			}
 		}
-
-		return fs.Resolve(params.File, cwd)
 	}
 
-	return fs.Resolve("j9d.yaml", cwd)
-}
-
-func deployCompose(ctx *ctxs.ExecContext) error {
-
 	hooks := ctx.Jolt9.Hooks
+	if hooks == nil {
+		hooks = &types.Hooks{}
+	}
 
-	if hooks != nil {
-		if len(hooks.Before) > 0 {
-			err := RunHooks(ctx, hooks.Before)
-			if err != nil {
-				return err
+	if err != nil {
+		ctx.Env["J9D_ERROR"] = err.Error()
+		herr := RunHooks(ctx, hooks.OnFailure)
+		if herr != nil {
+			logs.Errorf("on-failure hooks failed: %s", herr)
+		}
+
+		// hooks failing before or after the deploy leave the deployed
+		// release as is, only a failed deploy is rolled back.
+		var derr *driverError
+		if action == ActionDeploy && rollbackEnabled(ctx) && errors.As(err, &derr) {
+			rerr := rollback(ctx, d)
+			if rerr != nil {
+				err = fmt.Errorf("%w, rollback failed: %s", err, rerr)
 			}
 		}
 
-		if len(hooks.BeforeDeploy) > 0 {
-			err := RunHooks(ctx, hooks.BeforeDeploy)
-			if err != nil {
-				return err
-			}
+		herr = RunHooks(ctx, hooks.AfterFailure)
+		if herr != nil {
+			logs.Errorf("after-failure hooks failed: %s", herr)
 		}
 	}
 
-	j9d := ctx.Jolt9
-	context := j9d.Compose.Context
-	if context == "" {
-		context = "default"
-	}
-
-	if context != "default" {
-		if context != "default" {
-			err := ensureContext(context, ctx)
-			if err != nil {
-				return err
-			}
+	if len(hooks.Always) > 0 {
+		ctx.Env["J9D_STATUS"] = "success"
+		if err != nil {
+			ctx.Env["J9D_STATUS"] = "failure"
 		}
-	}
 
-	if j9d.Compose.Mode == "swarm" || j9d.Compose.Mode == "stack" {
-		args := []string{"stack", "rm", "--context", context}
-		for _, f := range j9d.Compose.Include {
-			args = append(args, "-c", f)
+		aerr := RunHooks(ctx, hooks.Always)
+		if aerr != nil && err == nil {
+			return aerr
 		}
 
-		proc := "docker"
-		if j9d.Compose.Sudo && !platform.IsWindows() && !cps.IsElevated() {
-			args = append([]string{"-E", "docker"}, args...)
-			proc = "sudo"
+		if aerr != nil {
+			logs.Errorf("always hooks failed: %s", aerr)
 		}
+	}
 
-		cmd := exec.New(proc, args...)
-		cmd.WithEnvMap(j9d.Env)
-
-		out, err := cmd.Run()
+	return err
+}
 
+// runAction runs the hooks before the action, the action and the hooks
+// after it.
+func runAction(ctx *ctxs.ExecContext, d Driver, action string) error {
+	before, after := hookStages(ctx.Jolt9.Hooks, action)
+	for _, stage := range before {
+		err := RunHooks(ctx, stage.tasks)
 		if err != nil {
 			return err
 		}
+	}
 
-		if out.Code != 0 {
-			return fmt.Errorf("docker stack deploy failed: %s", out.ErrorText())
-		}
+	var err error
+	if action == ActionRemove {
+		err = d.Remove(ctx)
 	} else {
-		args := []string{"--context", context, "compose", "--project-name", j9d.Name}
-		for _, f := range j9d.Compose.Include {
-			n, err := fs.Resolve(f, ctx.Cwd)
-
-			if err != nil {
-				return err
-			}
-
-			args = append(args, "-f", n)
-		}
-
-		args = append(args, "up", "-d")
-
-		proc := "docker"
-		if j9d.Compose.Sudo && !platform.IsWindows() && !cps.IsElevated() {
-			args = append([]string{"-E", "docker"}, args...)
-			proc = "sudo"
-		}
-
-		cmd := exec.New(proc, args...)
-		cmd.WithEnvMap(ctx.Env)
-
-		println(proc, strings.Join(args, " "))
-		for k, v := range ctx.Env {
-			println(k, v)
-
-			println(k, env.Get(k))
-		}
-
-		for _, l := range cmd.Cmd.Env {
-			println(l)
-		}
+		err = d.Deploy(ctx)
+	}
 
-		out, err := cmd.Run()
+	if err != nil {
+		return &driverError{err: err}
+	}
 
+	for _, stage := range after {
+		err = RunHooks(ctx, stage.tasks)
 		if err != nil {
 			return err
 		}
-
-		if out.Code != 0 {
-			return fmt.Errorf("docker compose up failed: %s", out.ErrorText())
-		}
-	}
-
-	if hooks != nil {
-		if len(hooks.After) > 0 {
-			err := RunHooks(ctx, hooks.After)
-			if err != nil {
-				return err
-			}
-		}
-
-		if len(hooks.AfterDeploy) > 0 {
-			err := RunHooks(ctx, hooks.AfterDeploy)
-			if err != nil {
-				return err
-			}
-		}
 	}
 
 	return nil
 }
 
-type RemoveParams struct {
-	CommonDeploymentParams
+// driverError is the error of the action of the driver, as opposed to
+// the errors of the hooks around it.
+type driverError struct {
+	err error
 }
 
-func Remove(params RemoveParams) error {
+func (e *driverError) Error() string {
+	return e.err.Error()
+}
 
-	file, err := getFile(params.CommonDeploymentParams)
-	if err != nil {
-		return err
-	}
+func (e *driverError) Unwrap() error {
+	return e.err
+}
 
-	ctx, err := ctxs.Load(file)
-	if err != nil {
-		return err
+func rollbackEnabled(ctx *ctxs.ExecContext) bool {
+	return ctx.Jolt9.Compose != nil && ctx.Jolt9.Compose.Rollback
+}
+
+// rollback deploys the last successful deploy of the driver.
+func rollback(ctx *ctxs.ExecContext, d Driver) error {
+	r, ok := d.(Rollbacker)
+	if !ok {
+		return fmt.Errorf("the %s driver does not support rollbacks", d.Name())
 	}
 
-	if ctx.Jolt9.Compose != nil {
-		removeCompose(ctx)
-	} else {
-		return fmt.Errorf("no deployment found e.g. compose block")
+	logs.Warnf("rolling back %s to the last successful deploy", ctx.Jolt9.Name)
+	err := r.Rollback(ctx)
+	if errors.Is(err, ErrNoSnapshot) {
+		logs.Warnf("%s: %s", ctx.Jolt9.Name, err)
+		return nil
 	}
 
-	return nil
+	return err
 }
 
-func ensureContext(context string, ctx *ctxs.ExecContext) error {
-	j9d := ctx.Jolt9
-	out, err := exec.Command("docker context ls --format '{{.Name}}'").Output()
+func load(params CommonDeploymentParams, dryRun bool) (*ctxs.ExecContext, error) {
+	file, wsf, err := getFile(params)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	lines := out.Lines()
-	if !slices.Contains(lines, ctx.Jolt9.Name) {
-		if j9d.Ssh == nil {
-			return fmt.Errorf("context %s not found", ctx.Jolt9.Name)
-		}
-
-		host := j9d.Ssh.Host
-		port := j9d.Ssh.Port
-		user := j9d.Ssh.User
-
-		if port < 1 {
-			port = 22
-		}
-
-		if strings.Contains(host, "$") {
-			host = env.ExpandSafe(host)
-		}
-
-		if strings.Contains(user, "$") {
-			user = env.ExpandSafe(user)
-		}
+	return ctxs.LoadWithParams(ctxs.LoadParams{
+		File:      file,
+		Target:    params.Target,
+		Workspace: wsf,
+		DryRun:    dryRun,
+	})
+}
 
-		format := fmt.Sprintf("ssh://%s@%s", user, host)
-		if port != 22 {
-			format = fmt.Sprintf("%s:%d", format, port)
-		}
+type hookStage struct {
+	name  string
+	tasks []types.Task
+}
 
-		out, err := exec.Command(fmt.Sprintf("docker context create %s --docker %s", ctx.Jolt9.Name, format)).Output()
-		if err != nil {
-			return err
-		}
+// hookStages returns the hooks that run before and after the driver
+// for the action in the order they run.
+func hookStages(hooks *types.Hooks, action string) ([]hookStage, []hookStage) {
+	if hooks == nil {
+		return nil, nil
+	}
 
-		if out.Code != 0 {
-			return fmt.Errorf("docker context create failed: %s", out.ErrorText())
-		}
+	if action == ActionRemove {
+		return []hookStage{{"before", hooks.Before}, {"before-remove", hooks.BeforeRemove}},
+			[]hookStage{{"after", hooks.After}, {"after-remove", hooks.AfterRemove}}
 	}
 
-	return nil
+	return []hookStage{{"before", hooks.Before}, {"before-deploy", hooks.BeforeDeploy}},
+		[]hookStage{{"after", hooks.After}, {"after-deploy", hooks.AfterDeploy}}
 }
 
-func removeCompose(ctx *ctxs.ExecContext) error {
-
-	hooks := ctx.Jolt9.Hooks
-	if hooks != nil {
-		if len(hooks.Before) > 0 {
-			err := RunHooks(ctx, hooks.Before)
-			if err != nil {
-				return err
-			}
-		}
-
-		if len(hooks.BeforeRemove) > 0 {
-			err := RunHooks(ctx, hooks.BeforeRemove)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	j9d := ctx.Jolt9
-	context := j9d.Compose.Context
-	if context == "" {
-		context = "default"
+// getFile returns the j9d file for the deployment params. When the
+// project is resolved through a workspace, the workspace file is
+// returned as well.
+func getFile(params CommonDeploymentParams) (string, *types.WorkspaceFile, error) {
+	cwd, err := cps.Cwd()
+	if err != nil {
+		return "", nil, err
 	}
 
-	if context != "default" {
-		err := ensureContext(context, ctx)
-		if err != nil {
-			return err
-		}
+	if params.Project == "" && params.File == "" {
+		return filepath.Join(cwd, "j9d.yaml"), nil, nil
 	}
 
-	if j9d.Compose.Mode == "swarm" || j9d.Compose.Mode == "stack" {
-		args := []string{"stack", "deploy", "--context", context}
-		for _, f := range j9d.Compose.Include {
-			args = append(args, "-c", f)
-		}
-
-		proc := "docker"
-		if j9d.Compose.Sudo && !platform.IsWindows() && !cps.IsElevated() {
-			args = append([]string{"-E", "docker"}, args...)
-			proc = "sudo"
-		}
-
-		cmd := exec.New(proc, args...)
-		cmd.WithEnvMap(ctx.Env)
-
-		out, err := cmd.Run()
-
-		if err != nil {
-			return err
-		}
-
-		if out.Code != 0 {
-			return fmt.Errorf("docker stack deploy failed: %s", out.ErrorText())
-		}
-	} else {
-		args := []string{"--context", context, "compose", "--project-name", j9d.Name}
-		for _, f := range j9d.Compose.Include {
-			n, err := fs.Resolve(f, ctx.Cwd)
-
-			if err != nil {
-				return err
+	if params.Project != "" {
+		if xstrings.Contains(params.Project, "/") {
+			parts := strings.Split(params.Project, "/")
+			// special project handling for local projects
+			// e.g. @cwd/project -> ./project/j9d.yaml
+			// j9d deploy -p @cwd/project -t dev => ./project/dev.j9d.yaml
+			// merged on top of ./project/j9d.yaml
+			if len(parts) == 2 && (parts[0] == "." || parts[0] == "@cwd") {
+				return localFile(filepath.Join(parts[1], "j9d.yaml"), cwd)
 			}
-
-			args = append(args, "-f", n)
 		}
 
-		args = append(args, "down")
-
-		proc := "docker"
-		if j9d.Compose.Sudo && !platform.IsWindows() && !cps.IsElevated() {
-			args = append([]string{"-E", "docker"}, args...)
-			proc = "sudo"
+		ref, err := workspaces.ParseProjectRef(params.Project)
+		if err != nil {
+			return "", nil, err
 		}
 
-		cmd := exec.New(proc, args...)
-		cmd.WithEnvMap(ctx.Env)
-
-		println(proc, strings.Join(args, " "))
-		for k, v := range ctx.Env {
-			println(k, v)
-
-			println(k, env.Get(k))
+		if params.Workspace != "" && !xstrings.Contains(params.Project, "/") {
+			ref.Workspace = workspaces.NormalizeName(params.Workspace)
 		}
 
-		for _, l := range cmd.Cmd.Env {
-			println(l)
+		wsf, err := workspaces.Load(ref.Workspace)
+		if err != nil {
+			return "", nil, err
 		}
 
-		out, err := cmd.Run()
-
+		file, err := workspaces.ResolveFile(wsf, ref.Project, params.Target)
 		if err != nil {
-			return err
+			return "", nil, err
 		}
 
-		if out.Code != 0 {
-			return fmt.Errorf("docker compose down failed: %s", out.ErrorText())
-		}
+		return file, wsf, nil
 	}
 
-	if hooks != nil {
-		if len(hooks.After) > 0 {
-			err := RunHooks(ctx, hooks.After)
-			if err != nil {
-				return err
-			}
+	if params.File != "" {
+		if params.File == "." {
+			return localFile("j9d.yaml", cwd)
 		}
 
-		if len(hooks.AfterRemove) > 0 {
-			err := RunHooks(ctx, hooks.AfterRemove)
-			if err != nil {
-				return err
+		// handle the case where you're in a root folder of many projects
+		// and you simply want to deploy the project using the subfolder name
+		// e.g.  j9d deploy -f myproject
+		if !filepath.IsAbs(params.File) {
+			ext := filepath.Ext(params.File)
+			if ext == "" {
+				base := filepath.Base(params.File)
+				if !strings.HasSuffix(base, "j9d") {
+					return localFile(filepath.Join(params.File, "j9d.yaml"), cwd)
+				} else {
+					return localFile(params.File+".yaml", cwd)
+				}
 			}
 		}
+
+		return localFile(params.File, cwd)
 	}
 
-	return nil
+	return localFile("j9d.yaml", cwd)
+}
+
+// localFile resolves a j9d file that is not loaded through a workspace.
+func localFile(file, cwd string) (string, *types.WorkspaceFile, error) {
+	file, err := fs.Resolve(file, cwd)
+	return file, nil, err
 }
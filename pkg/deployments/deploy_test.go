@@ -0,0 +1,87 @@
+package deployments_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingDriver fails every deploy of the j9d file named failing.
+type failingDriver struct{}
+
+func (d *failingDriver) Name() string {
+	return "failing"
+}
+
+func (d *failingDriver) Detect(j9d *types.Jolt9) bool {
+	return j9d.Name == "failing"
+}
+
+func (d *failingDriver) Validate(ctx *ctxs.ExecContext) error {
+	return nil
+}
+
+func (d *failingDriver) Plan(ctx *ctxs.ExecContext, action string, plan *deployments.Plan) error {
+	return nil
+}
+
+func (d *failingDriver) Deploy(ctx *ctxs.ExecContext) error {
+	return fmt.Errorf("driver failed")
+}
+
+func (d *failingDriver) Remove(ctx *ctxs.ExecContext) error {
+	return nil
+}
+
+func (d *failingDriver) Status(ctx *ctxs.ExecContext) (*deployments.Status, error) {
+	return nil, nil
+}
+
+func TestDeployFailureHooks(t *testing.T) {
+	deployments.RegisterDriver(&failingDriver{})
+
+	dir := t.TempDir()
+	content := `name: failing
+hooks:
+  after-deploy:
+    - run: touch after.txt
+  on-failure:
+    - use: shell
+      run: echo "$J9D_ERROR" > error.txt
+  after-failure:
+    - run: touch after-failure.txt
+  always:
+    - use: shell
+      run: echo "$J9D_STATUS" > status.txt
+`
+	file := filepath.Join(dir, "j9d.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+
+	params := deployments.DeployParams{}
+	params.File = file
+
+	err := deployments.Deploy(params)
+	assert.ErrorContains(t, err, "driver failed")
+
+	assert.NoFileExists(t, filepath.Join(dir, "after.txt"))
+	assert.FileExists(t, filepath.Join(dir, "after-failure.txt"))
+
+	data, err := os.ReadFile(filepath.Join(dir, "error.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "driver failed\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "status.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "failure\n", string(data))
+
+	plan, err := deployments.PlanDeploy(params)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Hooks, 4)
+	assert.Equal(t, "always", plan.Hooks[3].Stage)
+}
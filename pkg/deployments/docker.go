@@ -0,0 +1,202 @@
+package deployments
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/cps"
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/env"
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/platform"
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/jolt9dev/j9d/pkg/types"
+	exec "github.com/jolt9dev/j9d/pkg/xexec"
+	fs "github.com/jolt9dev/j9d/pkg/xfs"
+)
+
+// dockerCommand returns the process and arguments to run docker with,
+// using sudo when the compose block requires it.
+func dockerCommand(j9d *types.Jolt9, args []string) (string, []string) {
+	if j9d.Compose.Sudo && !platform.IsWindows() && !cps.IsElevated() {
+		return "sudo", append([]string{"-E", "docker"}, args...)
+	}
+
+	return "docker", args
+}
+
+// runDocker runs docker with the env of the exec context.
+func runDocker(ctx *ctxs.ExecContext, proc string, args []string) error {
+	cmd := exec.New(proc, args...)
+	cmd.WithEnvMap(ctx.Env)
+
+	for k, v := range ctx.Env {
+		logs.Tracef("env %s=%s", k, v)
+	}
+
+	out, err := cmd.Run()
+	if err != nil {
+		return err
+	}
+
+	if out.Code != 0 {
+		return fmt.Errorf("docker %s failed: %s", strings.Join(args, " "), out.ErrorText())
+	}
+
+	return nil
+}
+
+// composeContext returns the docker context of the compose block.
+func composeContext(j9d *types.Jolt9) string {
+	if j9d.Compose.Context == "" {
+		return "default"
+	}
+
+	return j9d.Compose.Context
+}
+
+// composeFiles returns the included compose files followed by the
+// inline compose definition. The inline definition is env expanded and
+// written to a private temp file that is removed by the returned func.
+// When dryRun is set, nothing is written and a placeholder is used.
+func composeFiles(ctx *ctxs.ExecContext, dryRun bool) ([]string, func(), error) {
+	cleanup := func() {}
+	files := []string{}
+	for _, f := range ctx.Jolt9.Compose.Include {
+		n, err := fs.Resolve(f, ctx.Cwd)
+		if err != nil {
+			return nil, cleanup, err
+		}
+
+		files = append(files, n)
+	}
+
+	if strings.TrimSpace(ctx.Jolt9.Compose.Inline) == "" {
+		return files, cleanup, nil
+	}
+
+	if dryRun {
+		return append(files, inlinePlaceholder), cleanup, nil
+	}
+
+	inline, err := expandInline(ctx)
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	f, err := os.CreateTemp("", "j9d-*.compose.yaml")
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	cleanup = func() {
+		os.Remove(f.Name())
+	}
+
+	// CreateTemp creates the file with 0600 so the expanded secrets
+	// are only readable by the current user.
+	_, err = f.WriteString(inline)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+
+	return append(files, f.Name()), cleanup, nil
+}
+
+// expandInline expands the env variables of the inline compose
+// definition using the env of the exec context.
+func expandInline(ctx *ctxs.ExecContext) (string, error) {
+	return env.Expand(ctx.Jolt9.Compose.Inline, &env.ExpandOptions{
+		Get: func(key string) string {
+			if val, ok := ctx.Env[key]; ok {
+				return val
+			}
+
+			return env.Get(key)
+		},
+		Set: func(key, value string) error {
+			return nil
+		},
+	})
+}
+
+// dockerHost returns the ssh:// docker host of the ssh block. Named
+// hosts e.g. @prod-1 are resolved and the user and port fall back to
+// ~/.ssh/config and $USER like the ssh driver. The host keeps its
+// ~/.ssh/config alias since docker connects with the ssh cli, which
+// applies the identity files, ProxyJump and known_hosts of the alias.
+func dockerHost(block *types.Ssh) (string, error) {
+	s, err := block.Resolve()
+	if err != nil {
+		return "", err
+	}
+
+	alias := env.ExpandSafe(s.Host)
+	user := env.ExpandSafe(s.User)
+	port := s.Port
+
+	hc, err := ssh.FindConfig(alias)
+	if err == nil {
+		if user == "" {
+			user = hc.User
+		}
+
+		if port == 0 {
+			port = hc.Port
+		}
+	} else if !errors.Is(err, ssh.ErrConfigNotFound) && !errors.Is(err, ssh.ErrHostNotFound) {
+		return "", err
+	}
+
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+
+	host := fmt.Sprintf("ssh://%s@%s", user, alias)
+	if port != 0 && port != 22 {
+		host = fmt.Sprintf("%s:%d", host, port)
+	}
+
+	return host, nil
+}
+
+func ensureContext(context string, ctx *ctxs.ExecContext) error {
+	j9d := ctx.Jolt9
+	out, err := exec.Command("docker context ls --format '{{.Name}}'").Output()
+	if err != nil {
+		return err
+	}
+
+	lines := out.Lines()
+	if !slices.Contains(lines, context) {
+		if j9d.Ssh == nil {
+			return fmt.Errorf("context %s not found", context)
+		}
+
+		host, err := dockerHost(j9d.Ssh)
+		if err != nil {
+			return err
+		}
+
+		out, err := exec.Command(fmt.Sprintf("docker context create %s --docker host=%s", context, host)).Output()
+		if err != nil {
+			return err
+		}
+
+		if out.Code != 0 {
+			return fmt.Errorf("docker context create failed: %s", out.ErrorText())
+		}
+	}
+
+	return nil
+}
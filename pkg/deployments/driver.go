@@ -0,0 +1,91 @@
+package deployments
+
+import (
+	"fmt"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/types"
+)
+
+const (
+	ActionDeploy = "deploy"
+	ActionRemove = "remove"
+)
+
+// Driver deploys and removes the block of a j9d file e.g. compose.
+// Hooks are run by the deployment for every driver, so drivers only
+// handle the block itself.
+type Driver interface {
+	// Name returns the name of the driver.
+	Name() string
+
+	// Detect returns true when the j9d file has the block handled by
+	// the driver.
+	Detect(j9d *types.Jolt9) bool
+
+	// Validate returns an error when the block can not be deployed.
+	Validate(ctx *ctxs.ExecContext) error
+
+	// Plan fills in the commands that the action would run without
+	// executing anything.
+	Plan(ctx *ctxs.ExecContext, action string, plan *Plan) error
+
+	Deploy(ctx *ctxs.ExecContext) error
+
+	Remove(ctx *ctxs.ExecContext) error
+
+	Status(ctx *ctxs.ExecContext) (*Status, error)
+}
+
+// Status is the state of a deployment reported by a driver.
+type Status struct {
+	Driver   string          `json:"driver"`
+	Name     string          `json:"name"`
+	Services []ServiceStatus `json:"services"`
+}
+
+type ServiceStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+var (
+	drivers     = make(map[string]Driver)
+	driverOrder = []string{}
+)
+
+// RegisterDriver registers the driver under its name. Drivers are
+// detected in the order they are registered, so drivers for a more
+// specific block e.g. compose in swarm mode must be registered first.
+func RegisterDriver(d Driver) {
+	if _, ok := drivers[d.Name()]; !ok {
+		driverOrder = append(driverOrder, d.Name())
+	}
+
+	drivers[d.Name()] = d
+}
+
+// GetDriver returns the driver registered under name.
+func GetDriver(name string) (Driver, bool) {
+	d, ok := drivers[name]
+	return d, ok
+}
+
+// FindDriver returns the first registered driver that detects its
+// block in the j9d file.
+func FindDriver(j9d *types.Jolt9) (Driver, error) {
+	for _, name := range driverOrder {
+		d := drivers[name]
+		if d.Detect(j9d) {
+			return d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no deployment found e.g. compose block")
+}
+
+func init() {
+	RegisterDriver(&swarmDriver{})
+	RegisterDriver(&composeDriver{})
+	RegisterDriver(&sshDriver{})
+}
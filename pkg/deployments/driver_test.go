@@ -0,0 +1,25 @@
+package deployments_test
+
+import (
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDriver(t *testing.T) {
+	d, err := deployments.FindDriver(&types.Jolt9{Compose: &types.Compose{}})
+	assert.NoError(t, err)
+	assert.Equal(t, "compose", d.Name())
+
+	d, err = deployments.FindDriver(&types.Jolt9{Compose: &types.Compose{Mode: "swarm"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "swarm", d.Name())
+
+	_, err = deployments.FindDriver(&types.Jolt9{})
+	assert.Error(t, err)
+
+	_, ok := deployments.GetDriver("compose")
+	assert.True(t, ok)
+}
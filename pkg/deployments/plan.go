@@ -0,0 +1,165 @@
+package deployments
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/types"
+)
+
+const (
+	redacted          = "******"
+	inlinePlaceholder = "<inline>"
+)
+
+// Plan describes what a deploy or remove would do without executing
+// anything or writing to vaults.
+type Plan struct {
+	Action    string            `json:"action"`
+	Driver    string            `json:"driver"`
+	File      string            `json:"file"`
+	Target    string            `json:"target"`
+	Files     []string          `json:"files"`
+	Inherits  []string          `json:"inherits"`
+	Vaults    []string          `json:"vaults"`
+	Generated []string          `json:"generated"`
+	Env       map[string]string `json:"env"`
+	Context   string            `json:"context"`
+	Inline    string            `json:"inline,omitempty"`
+	Hooks     []PlanHook        `json:"hooks"`
+	Commands  []string          `json:"commands"`
+}
+
+// PlanHook is a hook in the order it would run.
+type PlanHook struct {
+	Stage string            `json:"stage"`
+	Name  string            `json:"name"`
+	Use   string            `json:"use"`
+	On    string            `json:"on"`
+	Run   string            `json:"run"`
+	With  map[string]string `json:"with,omitempty"`
+}
+
+// PlanDeploy returns the plan for a deploy.
+func PlanDeploy(params DeployParams) (*Plan, error) {
+	return plan(ActionDeploy, params.CommonDeploymentParams)
+}
+
+// PlanRemove returns the plan for a remove.
+func PlanRemove(params RemoveParams) (*Plan, error) {
+	return plan(ActionRemove, params.CommonDeploymentParams)
+}
+
+func plan(action string, params CommonDeploymentParams) (*Plan, error) {
+	ctx, err := load(params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Action:    action,
+		File:      ctx.File,
+		Target:    ctx.Target,
+		Files:     ctx.Files,
+		Inherits:  ctx.Inherits,
+		Vaults:    ctx.Vaults,
+		Generated: ctx.Generated,
+		Env:       make(map[string]string),
+		Hooks:     []PlanHook{},
+		Commands:  []string{},
+	}
+
+	for k, v := range ctx.Env {
+		p.Env[k] = redact(ctx, k, v)
+	}
+
+	d, err := FindDriver(ctx.Jolt9)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Driver = d.Name()
+	err = d.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	before, after := hookStages(ctx.Jolt9.Hooks, action)
+	for _, stage := range before {
+		p.Hooks = append(p.Hooks, planHooks(ctx, stage.name, stage.tasks)...)
+	}
+
+	err = d.Plan(ctx, action, p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range after {
+		p.Hooks = append(p.Hooks, planHooks(ctx, stage.name, stage.tasks)...)
+	}
+
+	if hooks := ctx.Jolt9.Hooks; hooks != nil {
+		p.Hooks = append(p.Hooks, planHooks(ctx, "on-failure", hooks.OnFailure)...)
+		p.Hooks = append(p.Hooks, planHooks(ctx, "after-failure", hooks.AfterFailure)...)
+		p.Hooks = append(p.Hooks, planHooks(ctx, "always", hooks.Always)...)
+	}
+
+	return p, nil
+}
+
+func planHooks(ctx *ctxs.ExecContext, stage string, tasks []types.Task) []PlanHook {
+	hooks := []PlanHook{}
+	for _, t := range tasks {
+		use := t.Use
+		if use == "" {
+			use = "exec"
+		}
+
+		var with map[string]string
+		if len(t.With) > 0 {
+			with = map[string]string{}
+			for k, v := range t.With {
+				with[k] = redact(ctx, "", v)
+			}
+		}
+
+		hooks = append(hooks, PlanHook{
+			Stage: stage,
+			Name:  t.Name,
+			Use:   use,
+			On:    taskHost(ctx, t),
+			Run:   redact(ctx, "", t.Run),
+			With:  with,
+		})
+	}
+
+	return hooks
+}
+
+// redact masks the value when key is a secret or when the value
+// contains the value of a secret.
+func redact(ctx *ctxs.ExecContext, key, value string) string {
+	if _, ok := ctx.Secrets[key]; ok {
+		return redacted
+	}
+
+	// replace longer secrets first so that secrets which contain
+	// other secrets are fully masked.
+	values := []string{}
+	for _, v := range ctx.Secrets {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	for _, v := range values {
+		value = strings.ReplaceAll(value, v, redacted)
+	}
+
+	return value
+}
@@ -0,0 +1,157 @@
+package deployments_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanDeploy(t *testing.T) {
+	dir := t.TempDir()
+	content := `name: whoami
+env:
+  HOST: whoami.example.com
+hooks:
+  before:
+    - name: pull
+      run: docker pull traefik/whoami
+  after-deploy:
+    - name: notify
+      run: echo deployed
+compose:
+  include:
+    - compose.yaml
+`
+	file := filepath.Join(dir, "j9d.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+
+	params := deployments.DeployParams{}
+	params.File = file
+
+	plan, err := deployments.PlanDeploy(params)
+	assert.NoError(t, err)
+	assert.Equal(t, file, plan.File)
+	assert.Equal(t, "default", plan.Target)
+	assert.Equal(t, "whoami.example.com", plan.Env["HOST"])
+	assert.Len(t, plan.Hooks, 2)
+	assert.Equal(t, "before", plan.Hooks[0].Stage)
+	assert.Equal(t, "after-deploy", plan.Hooks[1].Stage)
+	assert.Equal(t, []string{
+		"docker --context default compose --project-name whoami -f " + filepath.Join(dir, "compose.yaml") + " up -d",
+	}, plan.Commands)
+
+	rp := deployments.RemoveParams{}
+	rp.File = file
+
+	plan, err = deployments.PlanRemove(rp)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Hooks, 1)
+	assert.Equal(t, []string{
+		"docker --context default compose --project-name whoami -f " + filepath.Join(dir, "compose.yaml") + " down",
+	}, plan.Commands)
+}
+
+func TestPlanStack(t *testing.T) {
+	dir := t.TempDir()
+	content := `name: whoami
+compose:
+  mode: swarm
+  context: swarm
+  with-registry-auth: true
+  prune: true
+  resolve-image: changed
+  include:
+    - compose.yaml
+`
+	file := filepath.Join(dir, "j9d.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+
+	params := deployments.DeployParams{}
+	params.File = file
+
+	plan, err := deployments.PlanDeploy(params)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"docker --context swarm stack deploy --compose-file " + filepath.Join(dir, "compose.yaml") +
+			" --with-registry-auth --prune --resolve-image changed whoami",
+	}, plan.Commands)
+
+	rp := deployments.RemoveParams{}
+	rp.File = file
+
+	plan, err = deployments.PlanRemove(rp)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docker --context swarm stack rm whoami"}, plan.Commands)
+}
+
+func TestPlanInline(t *testing.T) {
+	dir := t.TempDir()
+	content := `name: whoami
+env:
+  IMAGE: traefik/whoami
+compose:
+  include:
+    - compose.yaml
+  inline: |
+    services:
+      whoami:
+        image: ${IMAGE}
+`
+	file := filepath.Join(dir, "j9d.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+
+	params := deployments.DeployParams{}
+	params.File = file
+
+	plan, err := deployments.PlanDeploy(params)
+	assert.NoError(t, err)
+	assert.Contains(t, plan.Inline, "image: traefik/whoami")
+	assert.Equal(t, []string{
+		"docker --context default compose --project-name whoami -f " + filepath.Join(dir, "compose.yaml") + " -f <inline> up -d",
+	}, plan.Commands)
+}
+
+func TestPlanSsh(t *testing.T) {
+	dir := t.TempDir()
+	content := `name: nginx
+files:
+  - nginx.conf:/etc/nginx/conf.d/site.conf
+  - html/index.html
+ssh:
+  host: web-01
+  user: deploy
+  dir: /srv/site
+  deploy:
+    - name: restart
+      run: sudo systemctl restart nginx
+  remove:
+    - run: rm -rf /srv/site
+`
+	file := filepath.Join(dir, "j9d.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("server {}"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "html"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "html", "index.html"), []byte("ok"), 0644))
+
+	params := deployments.DeployParams{}
+	params.File = file
+
+	plan, err := deployments.PlanDeploy(params)
+	assert.NoError(t, err)
+	assert.Equal(t, "ssh", plan.Driver)
+	assert.Equal(t, []string{
+		"upload " + filepath.Join(dir, "nginx.conf") + " deploy@web-01:/etc/nginx/conf.d/site.conf",
+		"upload " + filepath.Join(dir, "html", "index.html") + " deploy@web-01:/srv/site/html/index.html",
+		"ssh deploy@web-01 sudo systemctl restart nginx",
+	}, plan.Commands)
+
+	rp := deployments.RemoveParams{}
+	rp.File = file
+
+	plan, err = deployments.PlanRemove(rp)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ssh deploy@web-01 rm -rf /srv/site"}, plan.Commands)
+}
@@ -0,0 +1,135 @@
+package deployments
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/paths"
+	exec "github.com/jolt9dev/j9d/pkg/xexec"
+)
+
+// ErrNoSnapshot is returned by Rollback when no deploy succeeded yet.
+var ErrNoSnapshot = errors.New("no previous deployment to roll back to")
+
+// Rollbacker is implemented by drivers that can restore the last
+// successful deploy when a deploy fails.
+type Rollbacker interface {
+	// Snapshot saves the deployed state after a successful deploy.
+	Snapshot(ctx *ctxs.ExecContext) error
+
+	// Rollback deploys the saved state or returns ErrNoSnapshot.
+	Rollback(ctx *ctxs.ExecContext) error
+}
+
+func (d *composeDriver) Snapshot(ctx *ctxs.ExecContext) error {
+	return snapshotCompose(ctx)
+}
+
+func (d *composeDriver) Rollback(ctx *ctxs.ExecContext) error {
+	return rollbackCompose(ctx, d.args)
+}
+
+func (d *swarmDriver) Snapshot(ctx *ctxs.ExecContext) error {
+	return snapshotCompose(ctx)
+}
+
+func (d *swarmDriver) Rollback(ctx *ctxs.ExecContext) error {
+	err := rollbackCompose(ctx, d.args)
+	if err != nil || ctx.Jolt9.Compose.NoWait {
+		return err
+	}
+
+	return waitForStack(ctx)
+}
+
+// snapshotFile returns the file of the compose spec of the last
+// successful deploy of the project in its docker context.
+func snapshotFile(ctx *ctxs.ExecContext) (string, error) {
+	dir, err := paths.DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "snapshots", composeContext(ctx.Jolt9), ctx.Jolt9.Name+".compose.yaml"), nil
+}
+
+// snapshotCompose saves the resolved compose spec with the images
+// pinned to their digests. Images that only exist locally can not be
+// resolved, so the spec is saved with its tags instead.
+func snapshotCompose(ctx *ctxs.ExecContext) error {
+	j9d := ctx.Jolt9
+	files, cleanup, err := composeFiles(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	args := []string{"--context", composeContext(j9d), "compose", "--project-name", j9d.Name}
+	for _, f := range files {
+		args = append(args, "-f", f)
+	}
+
+	spec, err := composeConfig(ctx, append(args, "config", "--resolve-image-digests"))
+	if err != nil {
+		logs.Warnf("unable to resolve the image digests of %s, saving image tags: %s", j9d.Name, err)
+		spec, err = composeConfig(ctx, append(args, "config"))
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := snapshotFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+
+	// the spec has the expanded env, so it is only readable by the
+	// current user.
+	tmp := file + ".tmp"
+	err = os.WriteFile(tmp, spec, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+func composeConfig(ctx *ctxs.ExecContext, args []string) ([]byte, error) {
+	proc, args := dockerCommand(ctx.Jolt9, args)
+	cmd := exec.New(proc, args...)
+	cmd.WithEnvMap(ctx.Env)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker compose config failed: %w %s", err, out.ErrorText())
+	}
+
+	return out.Stdout, nil
+}
+
+// rollbackCompose deploys the compose spec of the last successful
+// deploy.
+func rollbackCompose(ctx *ctxs.ExecContext, build composeArgs) error {
+	file, err := snapshotFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return ErrNoSnapshot
+	}
+
+	args := append([]string{"--context", composeContext(ctx.Jolt9)}, build(ctx, []string{file}, ActionDeploy)...)
+	proc, args := dockerCommand(ctx.Jolt9, args)
+	return runDocker(ctx, proc, args)
+}
@@ -0,0 +1,302 @@
+package deployments
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/env"
+	"github.com/jolt9dev/j9d/pkg/executors"
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/jolt9dev/j9d/pkg/xexec"
+)
+
+// TaskRunner runs the tasks of a use e.g. exec or http.
+type TaskRunner interface {
+	// Name returns the use handled by the runner.
+	Name() string
+
+	// Run runs the task once. Retries, conditions and
+	// continue-on-error are handled by the caller.
+	Run(tc *TaskContext) error
+}
+
+// TaskContext is the task passed to a task runner. Command has the
+// expanded run, env, cwd, timeout and stdio of the task and With has
+// the expanded inputs of the task.
+type TaskContext struct {
+	Exec       *ctxs.ExecContext
+	Task       types.Task
+	Executor   executors.Executor
+	Command    *executors.Command
+	With       map[string]string
+	EnvOptions *env.ExpandOptions
+}
+
+// Get returns the input or the default value when it is empty.
+func (tc *TaskContext) Get(key, defaultValue string) string {
+	if v := tc.With[key]; v != "" {
+		return v
+	}
+
+	return defaultValue
+}
+
+// Require returns the input or an error when it is empty.
+func (tc *TaskContext) Require(key string) (string, error) {
+	v := tc.With[key]
+	if v == "" {
+		return "", fmt.Errorf("task %s requires with.%s for use: %s", taskName(tc.Task), key, tc.Task.Use)
+	}
+
+	return v, nil
+}
+
+// IsLocal returns true when the task runs on this machine.
+func (tc *TaskContext) IsLocal() bool {
+	return tc.Executor.Name() == types.TaskOnLocal
+}
+
+var taskRunners = make(map[string]TaskRunner)
+
+// RegisterTaskRunner registers the runner under its name, replacing
+// a runner with the same name.
+func RegisterTaskRunner(r TaskRunner) {
+	taskRunners[r.Name()] = r
+}
+
+// GetTaskRunner returns the runner registered under name.
+func GetTaskRunner(name string) (TaskRunner, bool) {
+	r, ok := taskRunners[name]
+	return r, ok
+}
+
+// TaskRunners returns the names of the registered runners.
+func TaskRunners() []string {
+	names := make([]string, 0, len(taskRunners))
+	for name := range taskRunners {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// execRunner runs the run of the task as a command line without a
+// shell, or with the remote shell over ssh.
+type execRunner struct{}
+
+func (r *execRunner) Name() string {
+	return "exec"
+}
+
+func (r *execRunner) Run(tc *TaskContext) error {
+	_, err := tc.Executor.Run(tc.Command)
+	return err
+}
+
+// shellArgs are the args that run a script with each shell.
+var shellArgs = map[string][]string{
+	"sh":         {"-e", "-c"},
+	"bash":       {"--noprofile", "--norc", "-e", "-o", "pipefail", "-c"},
+	"zsh":        {"-e", "-c"},
+	"pwsh":       {"-NoLogo", "-NoProfile", "-NonInteractive", "-Command"},
+	"powershell": {"-NoLogo", "-NoProfile", "-NonInteractive", "-Command"},
+	"cmd":        {"/D", "/C"},
+}
+
+// shellRunner runs the run of the task as a script with the shell of
+// with.shell e.g. bash or pwsh. Local shells are found with the xexec
+// registry.
+type shellRunner struct{}
+
+func (r *shellRunner) Name() string {
+	return "shell"
+}
+
+func (r *shellRunner) Run(tc *TaskContext) error {
+	shell := tc.Get("shell", "sh")
+	if runtime.GOOS == "windows" && tc.IsLocal() {
+		shell = tc.Get("shell", "pwsh")
+	}
+
+	name := strings.ToLower(filepath.Base(shell))
+	name = strings.TrimSuffix(name, ".exe")
+	args, ok := shellArgs[name]
+	if !ok {
+		return fmt.Errorf("unsupported shell %s, expected one of sh, bash, zsh, pwsh, powershell or cmd", shell)
+	}
+
+	if tc.IsLocal() && !filepath.IsAbs(shell) {
+		exe, err := xexec.Find(shell, nil)
+		if err != nil {
+			return fmt.Errorf("shell %s not found: %w", shell, err)
+		}
+
+		shell = exe
+	}
+
+	cmd := *tc.Command
+	cmd.Args = append(append([]string{shell}, args...), tc.Command.Run)
+	_, err := tc.Executor.Run(&cmd)
+	return err
+}
+
+// dockerExecRunner runs the run of the task in the container of
+// with.container. Only the env of the task is passed to the
+// container.
+type dockerExecRunner struct{}
+
+func (r *dockerExecRunner) Name() string {
+	return "docker-exec"
+}
+
+func (r *dockerExecRunner) Run(tc *TaskContext) error {
+	container, err := tc.Require("container")
+	if err != nil {
+		return err
+	}
+
+	args := []string{"docker", "exec"}
+	if tc.Command.Stdin != nil {
+		args = append(args, "-i")
+	}
+
+	if user := tc.Get("user", ""); user != "" {
+		args = append(args, "-u", user)
+	}
+
+	if workdir := tc.Get("workdir", ""); workdir != "" {
+		args = append(args, "-w", workdir)
+	}
+
+	keys := []string{}
+	for k := range tc.Task.Env {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+tc.Command.Env[k])
+	}
+
+	args = append(args, container, tc.Get("shell", "sh"), "-c", tc.Command.Run)
+
+	cmd := *tc.Command
+	cmd.Args = args
+	_, err = tc.Executor.Run(&cmd)
+	return err
+}
+
+// templateRunner renders the file of with.src with the env of the task
+// and writes it to with.dest. Remote tasks upload the rendered file.
+type templateRunner struct{}
+
+func (r *templateRunner) Name() string {
+	return "template"
+}
+
+func (r *templateRunner) Run(tc *TaskContext) error {
+	src, err := tc.Require("src")
+	if err != nil {
+		return err
+	}
+
+	dest, err := tc.Require("dest")
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if m := tc.Get("mode", ""); m != "" {
+		v, err := strconv.ParseUint(m, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid mode %s for task %s: %w", m, taskName(tc.Task), err)
+		}
+
+		mode = os.FileMode(v)
+	}
+
+	if !filepath.IsAbs(src) {
+		src = filepath.Join(tc.Exec.Cwd, src)
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	content, err := env.Expand(string(data), tc.EnvOptions)
+	if err != nil {
+		return fmt.Errorf("unable to render %s: %w", src, err)
+	}
+
+	if tc.IsLocal() {
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(tc.Command.Cwd, dest)
+		}
+
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(dest, []byte(content), mode)
+		if err != nil {
+			return err
+		}
+
+		return os.Chmod(dest, mode)
+	}
+
+	e, ok := tc.Executor.(*executors.Ssh)
+	if !ok {
+		return fmt.Errorf("use: template is not supported on %s", tc.Executor.Name())
+	}
+
+	tmp, err := os.CreateTemp("", "j9d-template-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(content)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if !path.IsAbs(dest) {
+		dest = path.Join(tc.Command.Cwd, dest)
+	}
+
+	_, err = e.Client().Upload(tmp.Name(), dest, &ssh.TransferOptions{Mode: mode})
+	return err
+}
+
+func init() {
+	for name := range shellArgs {
+		if !xexec.Registry.Has(name) {
+			xexec.Register(name, &xexec.Executable{
+				Name:    name,
+				Linux:   []string{name},
+				Darwin:  []string{name},
+				Windows: []string{name + ".exe"},
+			})
+		}
+	}
+
+	RegisterTaskRunner(&execRunner{})
+	RegisterTaskRunner(&shellRunner{})
+	RegisterTaskRunner(&dockerExecRunner{})
+	RegisterTaskRunner(&templateRunner{})
+	RegisterTaskRunner(&httpRunner{})
+	RegisterTaskRunner(&waitForRunner{})
+}
@@ -0,0 +1,187 @@
+package deployments
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/logs"
+)
+
+// httpRunner sends the request of with.url and fails unless the
+// response has the status of with.status. Requests are sent from this
+// machine.
+type httpRunner struct{}
+
+func (r *httpRunner) Name() string {
+	return "http"
+}
+
+func (r *httpRunner) Run(tc *TaskContext) error {
+	u, err := tc.Require("url")
+	if err != nil {
+		return err
+	}
+
+	timeout := tc.Command.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	req, err := httpRequest(tc, u)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	status := tc.Get("status", "200")
+	if !statusMatches(res.StatusCode, status) {
+		return fmt.Errorf("%s %s returned %d, expected %s", req.Method, u, res.StatusCode, status)
+	}
+
+	logs.Infof("%s %s returned %d", req.Method, u, res.StatusCode)
+	return nil
+}
+
+// waitForRunner waits until the tcp address of with.tcp accepts
+// connections or the url of with.url returns the status of
+// with.status. Checks run from this machine every with.interval until
+// the timeout of the task, which defaults to 60s.
+type waitForRunner struct{}
+
+func (r *waitForRunner) Name() string {
+	return "wait-for"
+}
+
+func (r *waitForRunner) Run(tc *TaskContext) error {
+	addr := tc.Get("tcp", "")
+	u := tc.Get("url", "")
+	if addr == "" && u == "" {
+		return fmt.Errorf("task %s requires with.tcp or with.url for use: wait-for", taskName(tc.Task))
+	}
+
+	interval, err := time.ParseDuration(tc.Get("interval", "1s"))
+	if err != nil {
+		return fmt.Errorf("invalid interval for task %s: %w", taskName(tc.Task), err)
+	}
+
+	timeout := tc.Command.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+
+	target := addr
+	check := func() error {
+		conn, err := net.DialTimeout("tcp", addr, interval)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	}
+
+	if u != "" {
+		target = u
+		status := tc.Get("status", "2xx")
+		client := &http.Client{Timeout: interval}
+		check = func() error {
+			req, err := httpRequest(tc, u)
+			if err != nil {
+				return err
+			}
+
+			res, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+
+			defer res.Body.Close()
+			io.Copy(io.Discard, res.Body)
+			if !statusMatches(res.StatusCode, status) {
+				return fmt.Errorf("returned %d, expected %s", res.StatusCode, status)
+			}
+
+			return nil
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil {
+			logs.Infof("%s is ready", target)
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("timed out waiting for %s after %s: %w", target, timeout, err)
+		}
+
+		logs.Debugf("waiting for %s: %s", target, err)
+		time.Sleep(interval)
+	}
+}
+
+// httpRequest creates the request of the task from with.method,
+// with.body and with.headers, which are header lines e.g.
+// Authorization: Bearer $TOKEN.
+func httpRequest(tc *TaskContext, u string) (*http.Request, error) {
+	if _, err := url.ParseRequestURI(u); err != nil {
+		return nil, fmt.Errorf("invalid url %s for task %s: %w", u, taskName(tc.Task), err)
+	}
+
+	var body io.Reader
+	if b := tc.Get("body", ""); b != "" {
+		body = strings.NewReader(b)
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(tc.Get("method", http.MethodGet)), u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(tc.Get("headers", ""), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		req.Header.Set(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	return req, nil
+}
+
+// statusMatches returns true when the code matches one of the comma
+// separated statuses e.g. 200,204 or 2xx.
+func statusMatches(code int, statuses string) bool {
+	for _, s := range strings.Split(statuses, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len(s) == 3 && strings.HasSuffix(s, "xx") {
+			if strconv.Itoa(code/100) == s[:1] {
+				return true
+			}
+
+			continue
+		}
+
+		if s == strconv.Itoa(code) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,133 @@
+package deployments_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordRunner struct {
+	with map[string]string
+}
+
+func (r *recordRunner) Name() string {
+	return "record"
+}
+
+func (r *recordRunner) Run(tc *deployments.TaskContext) error {
+	r.with = tc.With
+	return nil
+}
+
+func TestRegisterTaskRunner(t *testing.T) {
+	r := &recordRunner{}
+	deployments.RegisterTaskRunner(r)
+
+	_, ok := deployments.GetTaskRunner("record")
+	assert.True(t, ok)
+
+	ctx := newTaskContext(t)
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "record", Use: "record", With: map[string]string{"stage": "$STAGE"}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", r.with["stage"])
+
+	err = deployments.RunHooks(ctx, []types.Task{{Name: "unknown", Use: "unknown"}})
+	assert.ErrorContains(t, err, "unknown use unknown")
+}
+
+func TestShellRunner(t *testing.T) {
+	ctx := newTaskContext(t)
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "shell", Use: "shell", Run: "echo $STAGE > stage.txt && test -s stage.txt"},
+	})
+
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(ctx.Cwd, "stage.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "prod\n", string(data))
+
+	err = deployments.RunHooks(ctx, []types.Task{
+		{Name: "fish", Use: "shell", Run: "true", With: map[string]string{"shell": "fish"}},
+	})
+
+	assert.ErrorContains(t, err, "unsupported shell fish")
+}
+
+func TestHttpRunner(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer prod" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	ctx := newTaskContext(t)
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "notify", Use: "http", With: map[string]string{
+			"url":     server.URL,
+			"method":  "post",
+			"headers": "Authorization: Bearer $STAGE",
+			"status":  "2xx",
+		}},
+	})
+
+	assert.NoError(t, err)
+
+	err = deployments.RunHooks(ctx, []types.Task{
+		{Name: "notify", Use: "http", With: map[string]string{"url": server.URL}},
+	})
+
+	assert.ErrorContains(t, err, "returned 403, expected 200")
+}
+
+func TestWaitForRunner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+
+	ctx := newTaskContext(t)
+	err = deployments.RunHooks(ctx, []types.Task{
+		{Name: "db", Use: "wait-for", With: map[string]string{"tcp": addr}},
+	})
+
+	assert.NoError(t, err)
+	l.Close()
+
+	err = deployments.RunHooks(ctx, []types.Task{
+		{Name: "db", Use: "wait-for", Timeout: "100ms", With: map[string]string{"tcp": addr, "interval": "20ms"}},
+	})
+
+	assert.ErrorContains(t, err, "timed out waiting for "+addr)
+}
+
+func TestTemplateRunner(t *testing.T) {
+	ctx := newTaskContext(t)
+	assert.NoError(t, os.WriteFile(filepath.Join(ctx.Cwd, "app.conf.tpl"), []byte("stage=${STAGE}\n"), 0644))
+
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "conf", Use: "template", With: map[string]string{"src": "app.conf.tpl", "dest": "conf/app.conf", "mode": "0600"}},
+	})
+
+	assert.NoError(t, err)
+	dest := filepath.Join(ctx.Cwd, "conf", "app.conf")
+	data, err := os.ReadFile(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "stage=prod\n", string(data))
+
+	fi, err := os.Stat(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
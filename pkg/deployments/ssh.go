@@ -0,0 +1,361 @@
+package deployments
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/env"
+	"github.com/jolt9dev/j9d/pkg/executors"
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/jolt9dev/j9d/pkg/types"
+	fs "github.com/jolt9dev/j9d/pkg/xfs"
+	"github.com/jolt9dev/j9d/pkg/xstrings"
+)
+
+// sshDriver uploads the files of the j9d file to a host and runs the
+// ssh tasks on it. It is used when there is an ssh block without a
+// compose block.
+type sshDriver struct{}
+
+// sshUpload is a local file and the remote path it is uploaded to.
+type sshUpload struct {
+	local  string
+	remote string
+}
+
+func (d *sshDriver) Name() string {
+	return "ssh"
+}
+
+func (d *sshDriver) Detect(j9d *types.Jolt9) bool {
+	return j9d.Ssh != nil
+}
+
+func (d *sshDriver) Validate(ctx *ctxs.ExecContext) error {
+	if ctx.Jolt9.Ssh.Host == "" {
+		return fmt.Errorf("ssh host is required for ssh deployments")
+	}
+
+	uploads, err := sshUploads(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range uploads {
+		if !fs.Exists(u.local) {
+			return fmt.Errorf("file %s not found", u.local)
+		}
+	}
+
+	return nil
+}
+
+func (d *sshDriver) Plan(ctx *ctxs.ExecContext, action string, plan *Plan) error {
+	dest := sshDestination(ctx.Jolt9.Ssh)
+	if action == ActionDeploy {
+		uploads, err := sshUploads(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range uploads {
+			plan.Commands = append(plan.Commands, fmt.Sprintf("upload %s %s:%s", u.local, dest, u.remote))
+		}
+	}
+
+	for _, t := range sshTasks(ctx.Jolt9.Ssh, action) {
+		plan.Commands = append(plan.Commands, fmt.Sprintf("ssh %s %s", dest, redact(ctx, "", t.Run)))
+	}
+
+	return nil
+}
+
+func (d *sshDriver) Deploy(ctx *ctxs.ExecContext) error {
+	e, err := newSshExecutor(ctx.Jolt9.Ssh)
+	if err != nil {
+		return err
+	}
+
+	defer e.Close()
+
+	uploads, err := sshUploads(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range uploads {
+		logs.Debugf("uploading %s to %s", u.local, u.remote)
+		err = sshUploadFile(e.Client(), u.local, u.remote)
+		if err != nil {
+			return err
+		}
+	}
+
+	return runSshTasks(ctx, e, ctx.Jolt9.Ssh.Deploy)
+}
+
+func (d *sshDriver) Remove(ctx *ctxs.ExecContext) error {
+	e, err := newSshExecutor(ctx.Jolt9.Ssh)
+	if err != nil {
+		return err
+	}
+
+	defer e.Close()
+
+	return runSshTasks(ctx, e, ctx.Jolt9.Ssh.Remove)
+}
+
+// Status runs the ssh status tasks and reports each task as ok or
+// failed. Without status tasks, the host is checked for reachability.
+func (d *sshDriver) Status(ctx *ctxs.ExecContext) (*Status, error) {
+	e, err := newSshExecutor(ctx.Jolt9.Ssh)
+	if err != nil {
+		return nil, err
+	}
+
+	defer e.Close()
+
+	status := &Status{
+		Driver:   d.Name(),
+		Name:     ctx.Jolt9.Name,
+		Services: []ServiceStatus{},
+	}
+
+	tasks := ctx.Jolt9.Ssh.Status
+	if len(tasks) == 0 {
+		status.Services = append(status.Services, ServiceStatus{Name: sshDestination(ctx.Jolt9.Ssh), Status: "reachable"})
+		return status, nil
+	}
+
+	err = ensureSshDir(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, t := range tasks {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("status-%d", i+1)
+		}
+
+		state := "ok"
+		err := runSshTask(ctx, e, t, nil, nil)
+		if err != nil {
+			state = "failed"
+		}
+
+		status.Services = append(status.Services, ServiceStatus{Name: name, Status: state})
+	}
+
+	return status, nil
+}
+
+func sshTasks(s *types.Ssh, action string) []types.Task {
+	if action == ActionRemove {
+		return s.Remove
+	}
+
+	return s.Deploy
+}
+
+func sshDestination(s *types.Ssh) string {
+	host := env.ExpandSafe(s.Host)
+	if s.User == "" {
+		return host
+	}
+
+	return env.ExpandSafe(s.User) + "@" + host
+}
+
+// sshUploads maps the files of the j9d file to remote paths. Files are
+// either local or local:remote. Relative remote paths are relative to
+// the ssh dir.
+func sshUploads(ctx *ctxs.ExecContext) ([]sshUpload, error) {
+	uploads := []sshUpload{}
+	for _, f := range ctx.Jolt9.Files {
+		local, remote, ok := strings.Cut(f, ":")
+		if !ok {
+			remote = filepath.ToSlash(local)
+			if filepath.IsAbs(local) {
+				remote = filepath.Base(local)
+			}
+		}
+
+		l, err := fs.Resolve(local, ctx.Cwd)
+		if err != nil {
+			return nil, err
+		}
+
+		if !path.IsAbs(remote) && ctx.Jolt9.Ssh.Dir != "" {
+			remote = path.Join(ctx.Jolt9.Ssh.Dir, remote)
+		}
+
+		uploads = append(uploads, sshUpload{local: l, remote: remote})
+	}
+
+	return uploads, nil
+}
+
+// newSshClient creates a client for the ssh block. The host may be a
+// named host e.g. @prod-1 or an alias in ~/.ssh/config, in which case
+// its ProxyJump hosts are connected through first.
+func newSshClient(block *types.Ssh) (*ssh.NativeClient, error) {
+	cfg, jumps, err := sshBlockConfig(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.NewClientWithJumps(cfg, jumps)
+}
+
+// sshBlockConfig resolves the named host of the ssh block, expands its
+// env variables and returns the ssh config of the host and its jump
+// hosts.
+func sshBlockConfig(block *types.Ssh) (*ssh.Config, []*ssh.Config, error) {
+	s, err := block.Resolve()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expanded := types.Ssh{
+		Host:         env.ExpandSafe(s.Host),
+		Port:         s.Port,
+		User:         env.ExpandSafe(s.User),
+		Identity:     env.ExpandSafe(s.Identity),
+		HostKeyCheck: s.HostKeyCheck,
+		Passphrase:   env.ExpandSafe(s.Passphrase),
+	}
+
+	return expanded.Config()
+}
+
+// sshUploadFile uploads the local file or directory to the remote path
+// over sftp. Unchanged files are skipped.
+func sshUploadFile(client *ssh.NativeClient, local, remote string) error {
+	remote = remotePath(remote)
+	if fs.IsDir(local) {
+		written, err := client.SyncDir(local, remote, nil)
+		logs.Debugf("uploaded %d changed files to %s", len(written), remote)
+		return err
+	}
+
+	ok, err := client.Upload(local, remote, nil)
+	if err == nil && !ok {
+		logs.Debugf("skipped %s, remote file is unchanged", local)
+	}
+
+	return err
+}
+
+func runSshTasks(ctx *ctxs.ExecContext, e executors.Executor, tasks []types.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	err := ensureSshDir(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		err := runSshTask(ctx, e, t, os.Stdout, os.Stderr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runSshTask runs the task in the ssh dir with the env of the exec
+// context and the task.
+func runSshTask(ctx *ctxs.ExecContext, e executors.Executor, t types.Task, stdout, stderr io.Writer) error {
+	vars, envOptions, err := taskEnv(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	skip, err := skipTask(t, envOptions)
+	if err != nil || skip {
+		return err
+	}
+
+	if xstrings.Contains(t.Cwd, "$") {
+		t.Cwd, err = env.Expand(t.Cwd, envOptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	timeout, err := taskTimeout(t)
+	if err != nil {
+		return err
+	}
+
+	run := t.Run
+	if t.Use == "" || t.Use == "exec" {
+		run = "set -e\n" + run
+	}
+
+	cmd := &executors.Command{
+		Run:     run,
+		Env:     vars,
+		Cwd:     remoteCwd(ctx.Jolt9.Ssh.Dir, t.Cwd),
+		Timeout: timeout,
+		Stdout:  stdout,
+		Stderr:  stderr,
+	}
+
+	return runTask(ctx, e, t, cmd, envOptions)
+}
+
+// ensureSshDir creates the ssh dir so that tasks can run in it.
+func ensureSshDir(ctx *ctxs.ExecContext, e executors.Executor) error {
+	dir := remotePath(ctx.Jolt9.Ssh.Dir)
+	if dir == "" {
+		return nil
+	}
+
+	_, err := e.Run(&executors.Command{Run: "mkdir -p " + executors.ShellQuote(dir)})
+	return err
+}
+
+// newSshExecutor connects to the host of the ssh block.
+func newSshExecutor(block *types.Ssh) (*executors.Ssh, error) {
+	client, err := newSshClient(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return executors.NewSsh(sshDestination(block), client)
+}
+
+// remoteCwd returns the working directory of a remote task with the
+// cwd of the task relative to the ssh dir.
+func remoteCwd(dir, cwd string) string {
+	if cwd == "" {
+		return remotePath(dir)
+	}
+
+	if path.IsAbs(cwd) || strings.HasPrefix(cwd, "~") {
+		return remotePath(cwd)
+	}
+
+	return path.Join(remotePath(dir), cwd)
+}
+
+// remotePath makes paths in the remote home directory relative since
+// the remote shell starts in it and quoted paths are not expanded.
+func remotePath(p string) string {
+	if p == "~" {
+		return "."
+	}
+
+	return strings.TrimPrefix(p, "~/")
+}
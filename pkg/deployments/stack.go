@@ -0,0 +1,247 @@
+package deployments
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/types"
+	exec "github.com/jolt9dev/j9d/pkg/xexec"
+)
+
+const defaultStackTimeout = 5 * time.Minute
+
+// swarmDriver deploys the compose block as a swarm stack when the
+// compose mode is swarm or stack.
+type swarmDriver struct{}
+
+func (d *swarmDriver) Name() string {
+	return "swarm"
+}
+
+func (d *swarmDriver) Detect(j9d *types.Jolt9) bool {
+	return j9d.Compose != nil && j9d.Compose.IsStack()
+}
+
+func (d *swarmDriver) Validate(ctx *ctxs.ExecContext) error {
+	err := validateCompose(ctx)
+	if err != nil {
+		return err
+	}
+
+	if j9d := ctx.Jolt9; j9d.Compose.Timeout != "" {
+		_, err = time.ParseDuration(j9d.Compose.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid compose timeout %s: %w", j9d.Compose.Timeout, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *swarmDriver) Plan(ctx *ctxs.ExecContext, action string, plan *Plan) error {
+	return planCompose(ctx, action, plan, d.args)
+}
+
+func (d *swarmDriver) Deploy(ctx *ctxs.ExecContext) error {
+	err := runCompose(ctx, ActionDeploy, d.args)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Jolt9.Compose.NoWait {
+		return nil
+	}
+
+	return waitForStack(ctx)
+}
+
+func (d *swarmDriver) Remove(ctx *ctxs.ExecContext) error {
+	return runCompose(ctx, ActionRemove, d.args)
+}
+
+func (d *swarmDriver) Status(ctx *ctxs.ExecContext) (*Status, error) {
+	j9d := ctx.Jolt9
+	proc, args := dockerCommand(j9d, []string{
+		"--context", composeContext(j9d),
+		"stack", "services", j9d.Name,
+		"--format", "{{.Name}}\t{{.Replicas}}",
+	})
+
+	return dockerStatus(ctx, d.Name(), proc, args)
+}
+
+// args returns the docker stack arguments that deploy the compose
+// files as a swarm stack or remove the stack.
+func (d *swarmDriver) args(ctx *ctxs.ExecContext, files []string, action string) []string {
+	j9d := ctx.Jolt9
+	if action == ActionRemove {
+		return []string{"stack", "rm", j9d.Name}
+	}
+
+	args := []string{"stack", "deploy"}
+	for _, f := range files {
+		args = append(args, "--compose-file", f)
+	}
+
+	if j9d.Compose.WithRegistryAuth {
+		args = append(args, "--with-registry-auth")
+	}
+
+	if j9d.Compose.Prune {
+		args = append(args, "--prune")
+	}
+
+	if j9d.Compose.ResolveImage != "" {
+		args = append(args, "--resolve-image", j9d.Compose.ResolveImage)
+	}
+
+	return append(args, j9d.Name)
+}
+
+// waitForStack waits until the replicas of every service in the stack
+// are running and their updates completed or the compose timeout
+// elapses.
+func waitForStack(ctx *ctxs.ExecContext) error {
+	j9d := ctx.Jolt9
+	timeout := defaultStackTimeout
+	if j9d.Compose.Timeout != "" {
+		d, err := time.ParseDuration(j9d.Compose.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid compose timeout %s: %w", j9d.Compose.Timeout, err)
+		}
+
+		timeout = d
+	}
+
+	proc, args := dockerCommand(j9d, []string{
+		"--context", composeContext(j9d),
+		"stack", "services", j9d.Name,
+		"--format", "{{.Name}}\t{{.Replicas}}",
+	})
+
+	deadline := time.Now().Add(timeout)
+	for {
+		cmd := exec.New(proc, args...)
+		cmd.WithEnvMap(ctx.Env)
+
+		out, err := cmd.Output()
+		if err != nil {
+			return err
+		}
+
+		if out.Code != 0 {
+			return fmt.Errorf("docker stack services failed: %s", out.ErrorText())
+		}
+
+		lines := out.Lines()
+		if stackConverged(lines) {
+			updated, err := stackUpdated(ctx, lines)
+			if err != nil {
+				return err
+			}
+
+			if updated {
+				logs.Debugf("stack %s converged", j9d.Name)
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("stack %s did not converge within %s", j9d.Name, timeout)
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// stackConverged returns true when every service of the replicas
+// output e.g. web 3/3 or agent 1/1 (max 1 per node) has the desired
+// replicas running.
+func stackConverged(lines []string) bool {
+	found := false
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 2 {
+			return false
+		}
+
+		parts := strings.SplitN(fields[1], "/", 2)
+		if len(parts) != 2 {
+			return false
+		}
+
+		running, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return false
+		}
+
+		desired, err := strconv.Atoi(parts[1])
+		if err != nil || running != desired {
+			return false
+		}
+
+		found = true
+	}
+
+	return found
+}
+
+// stackUpdated returns true when the update of every service of the
+// replicas output completed. The running replicas of a service that is
+// still updating may be the old tasks. Paused and rolled back updates
+// fail the deploy.
+func stackUpdated(ctx *ctxs.ExecContext, lines []string) (bool, error) {
+	j9d := ctx.Jolt9
+	args := []string{
+		"--context", composeContext(j9d),
+		"service", "inspect",
+		"--format", "{{.Spec.Name}}\t{{if .UpdateStatus}}{{.UpdateStatus.State}}{{end}}",
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			args = append(args, fields[0])
+		}
+	}
+
+	proc, args := dockerCommand(j9d, args)
+	cmd := exec.New(proc, args...)
+	cmd.WithEnvMap(ctx.Env)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+
+	if out.Code != 0 {
+		return false, fmt.Errorf("docker service inspect failed: %s", out.ErrorText())
+	}
+
+	for _, line := range out.Lines() {
+		parts := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(parts) != 2 {
+			// services that were never updated have no update status.
+			continue
+		}
+
+		switch parts[1] {
+		case "", "completed":
+		case "updating", "rollback_started":
+			logs.Debugf("service %s is %s", parts[0], parts[1])
+			return false, nil
+		default:
+			return false, fmt.Errorf("the update of service %s is %s", parts[0], parts[1])
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package deployments_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDocker puts a docker script on the path that deploys the stack
+// with all replicas running and prints the update states of the web
+// service in order, the last one is repeated.
+func fakeDocker(t *testing.T, states ...string) *ctxs.ExecContext {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on windows")
+	}
+
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+*"context ls"*) echo default ;;
+*"context create"*) echo "$*" > "` + dir + `/context" ;;
+*"stack deploy"*) exit 0 ;;
+*"stack services"*) printf 'whoami_web\t2/2\n' ;;
+*"service inspect"*)
+	n=$(cat "` + dir + `/count" 2>/dev/null || echo 0)
+	echo $((n + 1)) > "` + dir + `/count"
+	set -- '` + strings.Join(states, "' '") + `'
+	shift $((n < $# - 1 ? n : $# - 1))
+	printf 'whoami_web\t%s\n' "$1"
+	;;
+esac
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	compose := filepath.Join(dir, "compose.yaml")
+	assert.NoError(t, os.WriteFile(compose, []byte("services: {}\n"), 0644))
+
+	return &ctxs.ExecContext{
+		Env: map[string]string{"PATH": os.Getenv("PATH")},
+		Jolt9: &types.Jolt9{
+			Name: "whoami",
+			Compose: &types.Compose{
+				Mode:    "swarm",
+				Include: []string{compose},
+				Timeout: "10s",
+			},
+		},
+		Cwd: dir,
+	}
+}
+
+func TestSwarmDeployWaitsForUpdates(t *testing.T) {
+	ctx := fakeDocker(t, "updating", "completed")
+	d, ok := deployments.GetDriver("swarm")
+	assert.True(t, ok)
+
+	assert.NoError(t, d.Deploy(ctx))
+
+	data, err := os.ReadFile(filepath.Join(ctx.Cwd, "count"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2\n", string(data))
+}
+
+func TestSwarmDeployRolledBack(t *testing.T) {
+	ctx := fakeDocker(t, "rollback_completed")
+	d, ok := deployments.GetDriver("swarm")
+	assert.True(t, ok)
+
+	err := d.Deploy(ctx)
+	assert.ErrorContains(t, err, "the update of service whoami_web is rollback_completed")
+}
+
+func TestSwarmDeployCreatesContext(t *testing.T) {
+	ctx := fakeDocker(t, "completed")
+	ctx.Jolt9.Compose.Context = "prod"
+	ctx.Jolt9.Ssh = &types.Ssh{Host: "prod"}
+
+	// known_hosts is not read to create the docker context.
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, ".ssh", "known_hosts"), 0700))
+	config := "Host prod\n  HostName 10.0.0.5\n  User deploy\n  Port 2222\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(config), 0600))
+
+	d, ok := deployments.GetDriver("swarm")
+	assert.True(t, ok)
+	assert.NoError(t, d.Deploy(ctx))
+
+	data, err := os.ReadFile(filepath.Join(ctx.Cwd, "context"))
+	assert.NoError(t, err)
+	assert.Equal(t, "context create prod --docker host=ssh://deploy@prod:2222\n", string(data))
+}
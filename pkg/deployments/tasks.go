@@ -1,88 +1,344 @@
 package deployments
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/jolt9dev/j9d/pkg/ctxs"
 	"github.com/jolt9dev/j9d/pkg/env"
+	"github.com/jolt9dev/j9d/pkg/executors"
+	"github.com/jolt9dev/j9d/pkg/logs"
 	"github.com/jolt9dev/j9d/pkg/types"
-	"github.com/jolt9dev/j9d/pkg/xexec"
 	"github.com/jolt9dev/j9d/pkg/xstrings"
 )
 
+// RunHooks runs the tasks in order. Tasks run locally unless they are
+// on: remote or have a host, in which case they run over ssh.
 func RunHooks(ctx *ctxs.ExecContext, tasks []types.Task) error {
 
 	if len(tasks) == 0 {
 		return nil
 	}
 
+	execs := newTaskExecutors(ctx)
+	defer execs.Close()
+
 	for _, hook := range tasks {
+		vars, envOptions, err := taskEnv(ctx, hook)
+		if err != nil {
+			return err
+		}
 
-		if hook.Use == "" {
-			hook.Use = "exec"
+		skip, err := skipTask(hook, envOptions)
+		if err != nil {
+			return err
 		}
 
-		vars := map[string]string{}
-		for k, v := range ctx.Env {
-			vars[k] = v
+		if skip {
+			continue
 		}
 
-		envOptions := &env.ExpandOptions{
-			Get: func(key string) string {
-				if val, ok := vars[key]; ok {
-					return val
-				}
+		run := hook.Run
+		if xstrings.Contains(run, "$") {
+			run, err = env.Expand(run, envOptions)
+			if err != nil {
+				return err
+			}
+		}
 
-				return env.Get(key)
-			},
+		if xstrings.Contains(hook.Cwd, "$") {
+			hook.Cwd, err = env.Expand(hook.Cwd, envOptions)
+			if err != nil {
+				return err
+			}
+		}
 
-			Set: func(key, value string) error {
-				vars[key] = value
-				return nil
-			},
+		timeout, err := taskTimeout(hook)
+		if err != nil {
+			return err
 		}
 
-		if len(hook.Env) > 0 {
-			for k, v := range hook.Env {
-				if xstrings.Contains(v, "$") {
-					v, err := env.Expand(v, envOptions)
-					if err != nil {
-						return err
-					}
+		e, cwd, err := execs.Get(hook)
+		if err != nil {
+			return err
+		}
 
-					vars[k] = v
-					continue
-				}
+		cmd := &executors.Command{
+			Run:     run,
+			Env:     vars,
+			Cwd:     cwd,
+			Timeout: timeout,
+			Stdout:  os.Stdout,
+			Stderr:  os.Stderr,
+		}
 
-				vars[k] = v
-			}
+		// remote sessions read stdin until it is closed.
+		if e.Name() == types.TaskOnLocal {
+			cmd.Stdin = os.Stdin
 		}
 
-		switch hook.Use {
+		err = runTask(ctx, e, hook, cmd, envOptions)
+		if err != nil {
+			return err
+		}
+	}
 
-		case "exec":
-			run := hook.Run
-			if xstrings.Contains(run, "$") {
-				r, err := env.Expand(run, envOptions)
-				if err != nil {
-					return err
-				}
+	return nil
+}
 
-				run = r
+// taskEnv returns the env of the exec context with the env of the task
+// expanded on top of it.
+func taskEnv(ctx *ctxs.ExecContext, t types.Task) (map[string]string, *env.ExpandOptions, error) {
+	vars := map[string]string{}
+	for k, v := range ctx.Env {
+		vars[k] = v
+	}
+
+	envOptions := &env.ExpandOptions{
+		Get: func(key string) string {
+			if val, ok := vars[key]; ok {
+				return val
 			}
 
-			cmd := xexec.Command(run)
-			cmd.WithEnvMap(vars)
-			cmd.WithCwd(ctx.Cwd)
-			_, err := cmd.Run()
+			return env.Get(key)
+		},
+
+		Set: func(key, value string) error {
+			vars[key] = value
+			return nil
+		},
+	}
+
+	for k, v := range t.Env {
+		if xstrings.Contains(v, "$") {
+			v, err := env.Expand(v, envOptions)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			vars[k] = v
+			continue
+		}
+
+		vars[k] = v
+	}
+
+	return vars, envOptions, nil
+}
+
+// skipTask returns true when the if condition of the task is false. It
+// is checked before the executor of the task is resolved so that a
+// skipped task never connects to its host.
+func skipTask(t types.Task, envOptions *env.ExpandOptions) (bool, error) {
+	if t.If == "" {
+		return false, nil
+	}
+
+	name := taskName(t)
+	ok, err := evalCondition(t.If, envOptions)
+	if err != nil {
+		return false, fmt.Errorf("invalid if %q for task %s: %w", t.If, name, err)
+	}
+
+	if !ok {
+		logs.Infof("skipped task %s, %s is false", name, t.If)
+	}
+
+	return !ok, nil
+}
+
+// runTask runs the task with the runner of its use and runs it again
+// while it fails and has retries left. Its error is only logged with
+// continue-on-error.
+func runTask(ctx *ctxs.ExecContext, e executors.Executor, t types.Task, cmd *executors.Command, envOptions *env.ExpandOptions) error {
+	name := taskName(t)
+	if t.Use == "" {
+		t.Use = "exec"
+	}
+
+	runner, ok := GetTaskRunner(t.Use)
+	if !ok {
+		return fmt.Errorf("unknown use %s for task %s, expected one of %s", t.Use, name, strings.Join(TaskRunners(), ", "))
+	}
+
+	delay, err := taskRetryDelay(t)
+	if err != nil {
+		return err
+	}
+
+	with := map[string]string{}
+	for k, v := range t.With {
+		if xstrings.Contains(v, "$") {
+			v, err = env.Expand(v, envOptions)
 			if err != nil {
 				return err
 			}
+		}
+
+		with[k] = v
+	}
+
+	tc := &TaskContext{
+		Exec:       ctx,
+		Task:       t,
+		Executor:   e,
+		Command:    cmd,
+		With:       with,
+		EnvOptions: envOptions,
+	}
+
+	attempts := t.Retries + 1
+	for i := 1; ; i++ {
+		err := runner.Run(tc)
+		if err == nil {
+			return nil
+		}
+
+		if i < attempts {
+			logs.Warnf("task %s failed on %s, retry %d of %d in %s: %s", name, e.Name(), i, t.Retries, delay, err)
+			time.Sleep(delay)
+			delay *= 2
+			continue
+		}
+
+		var exitErr *executors.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("task %s failed on %s with exit code %d: %w", name, e.Name(), exitErr.Code, err)
+		} else {
+			err = fmt.Errorf("task %s failed on %s: %w", name, e.Name(), err)
+		}
 
-		default:
-			return fmt.Errorf("unknown hook use: %s", hook.Use)
+		if t.ContinueOnError {
+			logs.Warnf("%s", err)
+			return nil
 		}
+
+		return err
 	}
+}
 
-	return nil
+// taskName returns the name of the task or the first line of its run.
+func taskName(t types.Task) string {
+	if t.Name != "" {
+		return t.Name
+	}
+
+	name, _, _ := strings.Cut(strings.TrimSpace(t.Run), "\n")
+	return name
+}
+
+func taskRetryDelay(t types.Task) (time.Duration, error) {
+	if t.Retries < 0 {
+		return 0, fmt.Errorf("invalid retries %d for task %s", t.Retries, taskName(t))
+	}
+
+	if t.RetryDelay == "" {
+		return time.Second, nil
+	}
+
+	d, err := time.ParseDuration(t.RetryDelay)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retry-delay %s for task %s: %w", t.RetryDelay, taskName(t), err)
+	}
+
+	return d, nil
+}
+
+func taskTimeout(t types.Task) (time.Duration, error) {
+	if t.Timeout == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(t.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %s for task %s: %w", t.Timeout, taskName(t), err)
+	}
+
+	return d, nil
+}
+
+// taskHost returns where the task runs: local, the ssh destination of
+// the j9d file or the host of the task.
+func taskHost(ctx *ctxs.ExecContext, t types.Task) string {
+	if t.Host != "" {
+		return t.Host
+	}
+
+	if t.On == types.TaskOnRemote && ctx.Jolt9.Ssh != nil {
+		return sshDestination(ctx.Jolt9.Ssh)
+	}
+
+	return types.TaskOnLocal
+}
+
+// taskExecutors creates the executors of tasks and keeps ssh
+// connections open until Close.
+type taskExecutors struct {
+	ctx    *ctxs.ExecContext
+	local  executors.Executor
+	remote map[string]*executors.Ssh
+}
+
+func newTaskExecutors(ctx *ctxs.ExecContext) *taskExecutors {
+	return &taskExecutors{
+		ctx:    ctx,
+		local:  executors.NewLocal(),
+		remote: map[string]*executors.Ssh{},
+	}
+}
+
+// Get returns the executor of the task and the working directory the
+// task runs in.
+func (te *taskExecutors) Get(t types.Task) (executors.Executor, string, error) {
+	if t.Host != "" {
+		e, err := te.ssh(t.Host, &types.Ssh{Host: t.Host})
+		return e, t.Cwd, err
+	}
+
+	switch t.On {
+	case "", types.TaskOnLocal:
+		if t.Cwd != "" && !filepath.IsAbs(t.Cwd) {
+			return te.local, filepath.Join(te.ctx.Cwd, t.Cwd), nil
+		}
+
+		if t.Cwd != "" {
+			return te.local, t.Cwd, nil
+		}
+
+		return te.local, te.ctx.Cwd, nil
+
+	case types.TaskOnRemote:
+		if te.ctx.Jolt9.Ssh == nil {
+			return nil, "", fmt.Errorf("task %s runs on remote but there is no ssh block", taskName(t))
+		}
+
+		e, err := te.ssh(types.TaskOnRemote, te.ctx.Jolt9.Ssh)
+		return e, remoteCwd(te.ctx.Jolt9.Ssh.Dir, t.Cwd), err
+	}
+
+	return nil, "", fmt.Errorf("unknown task on: %s, expected local or remote", t.On)
+}
+
+func (te *taskExecutors) ssh(key string, block *types.Ssh) (*executors.Ssh, error) {
+	if e, ok := te.remote[key]; ok {
+		return e, nil
+	}
+
+	e, err := newSshExecutor(block)
+	if err != nil {
+		return nil, err
+	}
+
+	te.remote[key] = e
+	return e, nil
+}
+
+func (te *taskExecutors) Close() {
+	for _, e := range te.remote {
+		e.Close()
+	}
 }
@@ -0,0 +1,77 @@
+package deployments_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/ctxs"
+	"github.com/jolt9dev/j9d/pkg/deployments"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTaskContext(t *testing.T) *ctxs.ExecContext {
+	return &ctxs.ExecContext{
+		Env:   map[string]string{"STAGE": "prod"},
+		Jolt9: &types.Jolt9{},
+		Cwd:   t.TempDir(),
+	}
+}
+
+func TestRunHooksIf(t *testing.T) {
+	ctx := newTaskContext(t)
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "prod", Run: "touch prod.txt", If: "$STAGE == prod && !$SKIP"},
+		{Name: "dev", Run: "touch dev.txt", If: "$STAGE == dev || $DEV"},
+		{Name: "remote", Run: "true", On: types.TaskOnRemote, If: "$STAGE == dev"},
+	})
+
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(ctx.Cwd, "prod.txt"))
+	assert.NoFileExists(t, filepath.Join(ctx.Cwd, "dev.txt"))
+}
+
+func TestRunHooksRetries(t *testing.T) {
+	ctx := newTaskContext(t)
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "health", Run: `sh -c "test -f up || { touch up; exit 1; }"`, Retries: 2, RetryDelay: "10ms"},
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestRunHooksFailure(t *testing.T) {
+	ctx := newTaskContext(t)
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "migrate", Run: `sh -c "exit 3"`, Retries: 1, RetryDelay: "10ms"},
+	})
+
+	assert.ErrorContains(t, err, "task migrate failed on local with exit code 3")
+
+	err = deployments.RunHooks(ctx, []types.Task{
+		{Name: "notify", Run: `sh -c "exit 3"`, ContinueOnError: true},
+		{Name: "after", Run: "touch after.txt"},
+	})
+
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(ctx.Cwd, "after.txt"))
+}
+
+func TestRunHooksTimeoutAndCwd(t *testing.T) {
+	ctx := newTaskContext(t)
+	assert.NoError(t, os.Mkdir(filepath.Join(ctx.Cwd, "app"), 0755))
+
+	err := deployments.RunHooks(ctx, []types.Task{
+		{Name: "cwd", Run: "touch out.txt", Cwd: "app"},
+	})
+
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(ctx.Cwd, "app", "out.txt"))
+
+	err = deployments.RunHooks(ctx, []types.Task{
+		{Name: "slow", Run: "sleep 100", Timeout: "50ms"},
+	})
+
+	assert.ErrorContains(t, err, "timed out")
+}
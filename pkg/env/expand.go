@@ -159,7 +159,6 @@ func Expand(template string, options *ExpandOptions) (string, error) {
 			}
 
 			key := token.String()
-			println(key)
 			if len(key) == 0 {
 				return "", errors.New("bad substitution with empty variable name var")
 			}
@@ -0,0 +1,104 @@
+package executors
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/xexec"
+)
+
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Command is a command line run by an executor.
+type Command struct {
+	// Run is the command line e.g. pg_dump -f /backups/db.sql app
+	Run string
+
+	// Args is the program and its args. Args is run instead of Run
+	// when set, so args are passed as is e.g. bash -c "script".
+	Args []string
+
+	// Env is added to the env of the process.
+	Env map[string]string
+
+	// Cwd is the working directory. The home directory is used for
+	// remote commands when empty.
+	Cwd string
+
+	// Timeout stops the command when it runs longer. No timeout when
+	// zero.
+	Timeout time.Duration
+
+	// Stdin, Stdout and Stderr are connected to the process. Stdout
+	// and stderr are captured in the output when nil.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Executor runs commands on a host. Local and ssh executors run
+// commands with the same env, cwd, timeout and stdio semantics.
+type Executor interface {
+	// Name returns the host the executor runs commands on e.g. local.
+	Name() string
+
+	// Run runs the command and waits for it to finish. An error is
+	// returned when the command exits with a non zero code, the output
+	// is returned as well with the exit code.
+	Run(cmd *Command) (*xexec.PsOutput, error)
+
+	// Close releases the connection of the executor.
+	Close() error
+}
+
+// TimeoutError is returned when a command runs longer than its
+// timeout.
+type TimeoutError struct {
+	Run     string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %s: %s", e.Timeout, e.Run)
+}
+
+// ExitError is returned when a command exits with a non zero code.
+type ExitError struct {
+	Run  string
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command failed with code %d: %s", e.Code, e.Run)
+}
+
+// Line returns the command line of the command with the args quoted
+// for posix shells.
+func (c *Command) Line() string {
+	if len(c.Args) == 0 {
+		return c.Run
+	}
+
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = ShellQuote(arg)
+	}
+
+	return strings.Join(args, " ")
+}
+
+func envKeys(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		if envKeyPattern.MatchString(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
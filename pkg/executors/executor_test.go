@@ -0,0 +1,59 @@
+package executors_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/executors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalRun(t *testing.T) {
+	e := executors.NewLocal()
+	out, err := e.Run(&executors.Command{Run: "echo hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, out.Code)
+	assert.Equal(t, "hello\n", string(out.Stdout))
+}
+
+func TestLocalRunEnvAndCwd(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(dir+"/app.txt", []byte("app"), 0644))
+
+	e := executors.NewLocal()
+	out, err := e.Run(&executors.Command{Run: "cat app.txt", Cwd: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, "app", string(out.Stdout))
+
+	out, err = e.Run(&executors.Command{Run: "printenv J9D_EXEC_TEST", Env: map[string]string{"J9D_EXEC_TEST": "1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "1\n", string(out.Stdout))
+}
+
+func TestLocalRunExitCode(t *testing.T) {
+	e := executors.NewLocal()
+	out, err := e.Run(&executors.Command{Run: "false"})
+	var exitErr *executors.ExitError
+	assert.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, 1, exitErr.Code)
+	assert.Equal(t, 1, out.Code)
+}
+
+func TestLocalRunTimeout(t *testing.T) {
+	e := executors.NewLocal()
+	_, err := e.Run(&executors.Command{Run: "sleep 100", Timeout: 50 * time.Millisecond})
+	var timeoutErr *executors.TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+}
+
+func TestScript(t *testing.T) {
+	script := executors.Script(&executors.Command{
+		Run: "docker compose up -d",
+		Env: map[string]string{"B": "it's", "A": "1"},
+		Cwd: "/opt/app",
+	})
+
+	assert.Equal(t, "export A='1'\nexport B='it'\"'\"'s'\ncd '/opt/app' || exit 1\ndocker compose up -d\n", script)
+}
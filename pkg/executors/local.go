@@ -0,0 +1,91 @@
+package executors
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/xexec"
+)
+
+// Local runs commands on this machine through xexec.
+type Local struct{}
+
+// NewLocal returns an executor that runs commands on this machine.
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (l *Local) Name() string {
+	return "local"
+}
+
+func (l *Local) Close() error {
+	return nil
+}
+
+// Run runs the command line or the args without a shell. The env of the command is
+// added to the env of the current process.
+func (l *Local) Run(cmd *Command) (*xexec.PsOutput, error) {
+	var c *xexec.Cmd
+	if len(cmd.Args) > 0 {
+		c = xexec.New(cmd.Args[0], cmd.Args[1:]...)
+	} else {
+		c = xexec.Command(cmd.Run)
+	}
+
+	env := os.Environ()
+	for _, k := range envKeys(cmd.Env) {
+		env = append(env, k+"="+cmd.Env[k])
+	}
+
+	c.WithEnv(env...)
+	c.WithCwd(cmd.Cwd)
+	c.WithStdin(cmd.Stdin)
+	c.WithTimeout(cmd.Timeout)
+
+	var outb, errb bytes.Buffer
+	c.WithStdout(cmd.Stdout)
+	if cmd.Stdout == nil {
+		c.WithStdout(&outb)
+	}
+
+	c.WithStderr(cmd.Stderr)
+	if cmd.Stderr == nil {
+		c.WithStderr(&errb)
+	}
+
+	out := &xexec.PsOutput{
+		FileName:  c.Cmd.Path,
+		Args:      c.Cmd.Args,
+		StartedAt: time.Now().UTC(),
+	}
+
+	finish := func(err error) (*xexec.PsOutput, error) {
+		out.EndedAt = time.Now().UTC()
+		out.Stdout = outb.Bytes()
+		out.Stderr = errb.Bytes()
+		return out, err
+	}
+
+	err := c.Start()
+	if err != nil {
+		out.Code = 1
+		return finish(err)
+	}
+
+	err = c.Wait()
+	out.Code = c.Cmd.ProcessState.ExitCode()
+	if c.TimedOut() {
+		return finish(&TimeoutError{Run: cmd.Line(), Timeout: cmd.Timeout})
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return finish(&ExitError{Run: cmd.Line(), Code: out.Code})
+	}
+
+	return finish(err)
+}
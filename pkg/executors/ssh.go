@@ -0,0 +1,186 @@
+package executors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/jolt9dev/j9d/pkg/xexec"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Ssh runs commands on a remote host over ssh.
+type Ssh struct {
+	name   string
+	client *ssh.NativeClient
+}
+
+// NewSsh returns an executor that runs commands with the client. The
+// persistent connection of the client is started so that commands
+// share one connection until Close.
+func NewSsh(name string, client *ssh.NativeClient) (*Ssh, error) {
+	err := client.StartPersistentConn(client.DefaultClientConfig.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ssh{name: name, client: client}, nil
+}
+
+func (s *Ssh) Name() string {
+	return s.name
+}
+
+// Client returns the ssh client of the executor.
+func (s *Ssh) Client() *ssh.NativeClient {
+	return s.client
+}
+
+func (s *Ssh) Close() error {
+	s.client.StopPersistentConn()
+	return nil
+}
+
+// Run runs the command line with the remote shell. The env is exported
+// by a script that is piped to the shell so that env values are not
+// part of the remote command line. When the command has stdin, the
+// script is written to a temp file first.
+func (s *Ssh) Run(cmd *Command) (*xexec.PsOutput, error) {
+	script := Script(cmd)
+	out := &xexec.PsOutput{
+		FileName:  "ssh",
+		Args:      []string{s.name, cmd.Line()},
+		StartedAt: time.Now().UTC(),
+	}
+
+	var outb, errb bytes.Buffer
+	stdout, stderr := cmd.Stdout, cmd.Stderr
+	if stdout == nil {
+		stdout = &outb
+	}
+
+	if stderr == nil {
+		stderr = &errb
+	}
+
+	finish := func(err error) (*xexec.PsOutput, error) {
+		out.EndedAt = time.Now().UTC()
+		out.Stdout = outb.Bytes()
+		out.Stderr = errb.Bytes()
+		return out, err
+	}
+
+	remote := "sh -s"
+	stdin := io.Reader(strings.NewReader(script))
+	if cmd.Stdin != nil {
+		file, err := s.writeScript(script)
+		if err != nil {
+			out.Code = 1
+			return finish(err)
+		}
+
+		f := ShellQuote(file)
+		remote = fmt.Sprintf("sh %s; rc=$?; rm -f %s; exit $rc", f, f)
+		stdin = cmd.Stdin
+	}
+
+	session, sessionInfo, err := s.client.Session(s.client.DefaultClientConfig.Timeout)
+	if err != nil {
+		out.Code = 1
+		return finish(err)
+	}
+
+	defer sessionInfo.CloseAll()
+	defer session.Close()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	logs.Debugf("ssh %s: %s", s.name, cmd.Line())
+	err = session.Start(remote)
+	if err != nil {
+		out.Code = 1
+		return finish(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if cmd.Timeout > 0 {
+		timer := time.NewTimer(cmd.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err = <-done:
+	case <-timeout:
+		session.Signal(gossh.SIGKILL)
+		session.Close()
+		out.Code = -1
+		return finish(&TimeoutError{Run: cmd.Line(), Timeout: cmd.Timeout})
+	}
+
+	var exitErr *gossh.ExitError
+	if errors.As(err, &exitErr) {
+		out.Code = exitErr.ExitStatus()
+		return finish(&ExitError{Run: cmd.Line(), Code: out.Code})
+	}
+
+	if err != nil {
+		out.Code = 1
+	}
+
+	return finish(err)
+}
+
+// writeScript writes the script to a private remote temp file and
+// returns its path.
+func (s *Ssh) writeScript(script string) (string, error) {
+	session, sessionInfo, err := s.client.Session(s.client.DefaultClientConfig.Timeout)
+	if err != nil {
+		return "", err
+	}
+
+	defer sessionInfo.CloseAll()
+	defer session.Close()
+
+	session.Stdin = strings.NewReader(script)
+	out, err := session.Output(`umask 077; f=$(mktemp) && cat > "$f" && echo "$f"`)
+	if err != nil {
+		return "", fmt.Errorf("unable to write remote script: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Script returns the shell script that runs the command with its env
+// exported in its working directory.
+func Script(cmd *Command) string {
+	script := strings.Builder{}
+	for _, k := range envKeys(cmd.Env) {
+		script.WriteString(fmt.Sprintf("export %s=%s\n", k, ShellQuote(cmd.Env[k])))
+	}
+
+	if cmd.Cwd != "" {
+		script.WriteString(fmt.Sprintf("cd %s || exit 1\n", ShellQuote(cmd.Cwd)))
+	}
+
+	script.WriteString(cmd.Line())
+	script.WriteString("\n")
+	return script.String()
+}
+
+// ShellQuote quotes the value for posix shells.
+func ShellQuote(s string) string {
+	return ssh.ShellQuote(s)
+}
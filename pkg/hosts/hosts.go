@@ -0,0 +1,151 @@
+package hosts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/jolt9dev/j9d/pkg/types"
+)
+
+// TestResult is the result of connecting to a host.
+type TestResult struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Latency string `json:"latency"`
+	OS      string `json:"os"`
+}
+
+// NormalizeName removes the leading @ from a host name.
+func NormalizeName(name string) string {
+	return strings.TrimPrefix(strings.TrimSpace(name), "@")
+}
+
+// Add adds the host to the global config under name. An existing host
+// is only replaced with force.
+func Add(cfg *types.GlobalConfig, name string, host types.Host, force bool) error {
+	name = NormalizeName(name)
+	if name == "" || strings.ContainsAny(name, "/@ ") {
+		return fmt.Errorf("invalid host name %q", name)
+	}
+
+	if host.Host == "" {
+		return fmt.Errorf("host @%s has no address", name)
+	}
+
+	if cfg.Hosts == nil {
+		cfg.Hosts = make(map[string]types.Host)
+	}
+
+	if _, ok := cfg.Hosts[name]; ok && !force {
+		return fmt.Errorf("host @%s already exists", name)
+	}
+
+	cfg.Hosts[name] = host
+	return nil
+}
+
+// Remove removes the host from the global config.
+func Remove(cfg *types.GlobalConfig, name string) bool {
+	name = NormalizeName(name)
+	if _, ok := cfg.Hosts[name]; !ok {
+		return false
+	}
+
+	delete(cfg.Hosts, name)
+	return true
+}
+
+// Get returns the host registered under name.
+func Get(cfg *types.GlobalConfig, name string) (types.Host, error) {
+	h, ok := cfg.Host(NormalizeName(name))
+	if !ok {
+		return h, fmt.Errorf("host @%s not found", NormalizeName(name))
+	}
+
+	return h, nil
+}
+
+// Address returns the host in the user@host:port format.
+func Address(h types.Host) string {
+	addr := h.Host
+	if h.User != "" {
+		addr = h.User + "@" + addr
+	}
+
+	if h.Port != 0 {
+		addr = fmt.Sprintf("%s:%d", addr, h.Port)
+	}
+
+	return addr
+}
+
+// Connect creates a client for the host that connects through its
+// jump hosts.
+func Connect(h types.Host) (*ssh.NativeClient, error) {
+	cfg, jumps, err := h.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.NewClientWithJumps(cfg, jumps)
+}
+
+// Test connects to the host and returns the connect latency and the
+// remote os.
+func Test(name string, h types.Host) (*TestResult, error) {
+	client, err := Connect(h)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	err = client.StartPersistentConn(client.DefaultClientConfig.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	latency := time.Since(start)
+	defer client.StopPersistentConn()
+
+	remoteOS, err := client.Output("uname -srm")
+	if err != nil {
+		return nil, fmt.Errorf("uname failed: %w", err)
+	}
+
+	release, err := client.Output(`. /etc/os-release 2>/dev/null && echo "$PRETTY_NAME"`)
+	if err == nil && release != "" {
+		remoteOS = fmt.Sprintf("%s (%s)", release, remoteOS)
+	}
+
+	return &TestResult{
+		Name:    NormalizeName(name),
+		Address: Address(h),
+		Latency: latency.Round(time.Millisecond).String(),
+		OS:      remoteOS,
+	}, nil
+}
+
+// InstallKey appends the public key to ~/.ssh/authorized_keys on the
+// host unless it is already there.
+func InstallKey(h types.Host, publicKey []byte) error {
+	key := strings.TrimSpace(string(publicKey))
+	if key == "" || strings.ContainsAny(key, "'\n") {
+		return fmt.Errorf("invalid public key")
+	}
+
+	client, err := Connect(h)
+	if err != nil {
+		return err
+	}
+
+	cmd := fmt.Sprintf("mkdir -p ~/.ssh && chmod 700 ~/.ssh && touch ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys && "+
+		"(grep -qxF '%s' ~/.ssh/authorized_keys || echo '%s' >> ~/.ssh/authorized_keys)", key, key)
+	out, err := client.Output(cmd)
+	if err != nil {
+		return fmt.Errorf("installing key failed: %w %s", err, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package hosts_test
+
+import (
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/hosts"
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddAndRemove(t *testing.T) {
+	cfg := &types.GlobalConfig{}
+	h := types.Host{Host: "10.0.0.5", User: "deploy", Port: 2222}
+
+	assert.NoError(t, hosts.Add(cfg, "@prod-1", h, false))
+	assert.Error(t, hosts.Add(cfg, "prod-1", h, false))
+	assert.NoError(t, hosts.Add(cfg, "prod-1", types.Host{Host: "10.0.0.6"}, true))
+	assert.Error(t, hosts.Add(cfg, "a/b", h, false))
+	assert.Error(t, hosts.Add(cfg, "empty", types.Host{}, false))
+
+	got, err := hosts.Get(cfg, "@prod-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.6", got.Host)
+
+	assert.True(t, hosts.Remove(cfg, "@prod-1"))
+	assert.False(t, hosts.Remove(cfg, "prod-1"))
+
+	_, err = hosts.Get(cfg, "prod-1")
+	assert.Error(t, err)
+}
+
+func TestAddress(t *testing.T) {
+	assert.Equal(t, "deploy@10.0.0.5:2222", hosts.Address(types.Host{Host: "10.0.0.5", User: "deploy", Port: 2222}))
+	assert.Equal(t, "prod-db", hosts.Address(types.Host{Host: "prod-db"}))
+}
@@ -0,0 +1,171 @@
+package logs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Level int
+
+const (
+	TraceLevel Level = iota
+	DebugLevel
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+const mask = "******"
+
+var (
+	level   Level     = InfoLevel
+	out     io.Writer = os.Stderr
+	secrets []string
+	mu      sync.RWMutex
+)
+
+func (l Level) String() string {
+	switch l {
+	case TraceLevel:
+		return "trace"
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	}
+
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses the name of a level e.g. debug.
+func ParseLevel(s string) (Level, error) {
+	for _, l := range []Level{TraceLevel, DebugLevel, InfoLevel, WarnLevel, ErrorLevel} {
+		if strings.EqualFold(strings.TrimSpace(s), l.String()) {
+			return l, nil
+		}
+	}
+
+	return InfoLevel, fmt.Errorf("unknown log level %q, use trace, debug, info, warn or error", s)
+}
+
+// SetLevel sets the minimum level of the messages that are written.
+func SetLevel(l Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	level = l
+}
+
+func GetLevel() Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	return level
+}
+
+// Enabled returns true when messages for the level are written.
+func Enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+// SetOutput sets the writer that messages are written to. Defaults
+// to stderr.
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+}
+
+// AddSecret registers values that are masked in every message.
+func AddSecret(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, v := range values {
+		if v == "" || contains(secrets, v) {
+			continue
+		}
+
+		secrets = append(secrets, v)
+	}
+
+	// longer secrets are masked first so that secrets which contain
+	// other secrets are fully masked.
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+}
+
+// ClearSecrets removes all registered secrets.
+func ClearSecrets() {
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = []string{}
+}
+
+// Mask replaces every registered secret in s.
+func Mask(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, v := range secrets {
+		s = strings.ReplaceAll(s, v, mask)
+	}
+
+	return s
+}
+
+func Tracef(format string, args ...interface{}) {
+	write(TraceLevel, format, args...)
+}
+
+func Debugf(format string, args ...interface{}) {
+	write(DebugLevel, format, args...)
+}
+
+func Infof(format string, args ...interface{}) {
+	write(InfoLevel, format, args...)
+}
+
+func Warnf(format string, args ...interface{}) {
+	write(WarnLevel, format, args...)
+}
+
+func Errorf(format string, args ...interface{}) {
+	write(ErrorLevel, format, args...)
+}
+
+func write(l Level, format string, args ...interface{}) {
+	if !Enabled(l) {
+		return
+	}
+
+	msg := Mask(fmt.Sprintf(format, args...))
+
+	mu.RLock()
+	w := out
+	mu.RUnlock()
+
+	if l == InfoLevel {
+		fmt.Fprintln(w, msg)
+		return
+	}
+
+	fmt.Fprintf(w, "[%s] %s\n", l, msg)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
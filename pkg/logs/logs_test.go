@@ -0,0 +1,53 @@
+package logs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logs.SetOutput(buf)
+	logs.SetLevel(logs.InfoLevel)
+
+	logs.Debugf("hidden")
+	logs.Infof("shown %d", 1)
+	logs.Errorf("failed")
+
+	assert.Equal(t, "shown 1\n[error] failed\n", buf.String())
+
+	buf.Reset()
+	logs.SetLevel(logs.ErrorLevel)
+	logs.Infof("hidden")
+	logs.Warnf("hidden")
+	assert.Empty(t, buf.String())
+}
+
+func TestMask(t *testing.T) {
+	defer logs.ClearSecrets()
+
+	buf := &bytes.Buffer{}
+	logs.SetOutput(buf)
+	logs.SetLevel(logs.DebugLevel)
+	logs.AddSecret("pass", "password123", "")
+
+	logs.Debugf("docker login -p password123 --user pass")
+	assert.Equal(t, "[debug] docker login -p ****** --user ******\n", buf.String())
+	assert.Equal(t, "no secrets", logs.Mask("no secrets"))
+}
+
+func TestParseLevel(t *testing.T) {
+	l, err := logs.ParseLevel("TRACE")
+	assert.NoError(t, err)
+	assert.Equal(t, logs.TraceLevel, l)
+
+	l, err = logs.ParseLevel("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, logs.WarnLevel, l)
+
+	_, err = logs.ParseLevel("loud")
+	assert.Error(t, err)
+}
@@ -0,0 +1,290 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	terminal "golang.org/x/term"
+)
+
+// ErrPassphraseRequired is returned for encrypted keys when there is no
+// passphrase and no way to prompt for one.
+var ErrPassphraseRequired = errors.New("passphrase required to decrypt key")
+
+// PromptPassphrase asks for the passphrase of the key on the terminal.
+func PromptPassphrase(name string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w %s", ErrPassphraseRequired, name)
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", name)
+	defer fmt.Fprintln(os.Stderr)
+
+	return terminal.ReadPassword(fd)
+}
+
+// authMethods returns the auth methods of the auth. All keys are
+// offered through one public key method since the ssh client tries
+// each method only once. Keys that can not be read or decrypted are
+// skipped, an error is only returned when no auth method is left.
+func (a *Auth) authMethods() ([]ssh.AuthMethod, error) {
+	methods := []ssh.AuthMethod{}
+
+	useAgent := false
+	agentKeys := map[string]bool{}
+	if a.Agent {
+		keys, err := a.agentKeys()
+		if err != nil {
+			logs.Warnf("ssh agent unavailable, using key files: %v", err)
+		} else if keys != nil {
+			useAgent = true
+			for _, k := range keys {
+				agentKeys[string(k.Marshal())] = true
+			}
+		}
+	}
+
+	skipped := []error{}
+	signers := []ssh.Signer{}
+	for _, k := range a.Keys {
+		// skip encrypted keys that are in the agent to avoid asking
+		// for a passphrase.
+		if pub, err := readPublicKey(k + ".pub"); err == nil && agentKeys[string(pub.Marshal())] {
+			logs.Tracef("ssh key %s is in the agent", k)
+			continue
+		}
+
+		signer, err := a.readKey(k)
+		if err != nil {
+			logs.Debugf("skipping ssh key %s: %v", k, err)
+			skipped = append(skipped, err)
+			continue
+		}
+
+		signers = append(signers, signer...)
+	}
+
+	for i, key := range a.RawKeys {
+		name := fmt.Sprintf("raw key %d", i+1)
+		signer, err := a.parseKey(name, key)
+		if err != nil {
+			logs.Debugf("skipping ssh %s: %v", name, err)
+			skipped = append(skipped, err)
+			continue
+		}
+
+		signers = append(signers, signer)
+	}
+
+	for _, keypair := range a.KeyPairs {
+		signer, err := keypair.getSigner()
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	if len(signers) > 0 || useAgent || a.KeyPairsCallback != nil {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			all := append([]ssh.Signer{}, signers...)
+			if useAgent {
+				all = append(all, a.agentSigners()...)
+			}
+
+			if a.KeyPairsCallback != nil {
+				keypairs, err := a.KeyPairsCallback()
+				if err != nil {
+					return nil, err
+				}
+				for _, keypair := range keypairs {
+					signer, err := keypair.getSigner()
+					if err != nil {
+						return nil, err
+					}
+					all = append(all, signer)
+				}
+			}
+
+			return all, nil
+		}))
+	}
+
+	for _, p := range a.Passwords {
+		methods = append(methods, ssh.Password(p))
+	}
+
+	if len(skipped) > 0 && len(signers) == 0 && len(agentKeys) == 0 && a.KeyPairsCallback == nil && len(a.Passwords) == 0 {
+		return nil, errors.Join(skipped...)
+	}
+
+	return methods, nil
+}
+
+// readKey returns the signer of the key file and of its certificate
+// when there is a -cert.pub file next to it.
+func (a *Auth) readKey(file string) ([]ssh.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := a.parseKey(file, data)
+	if err != nil {
+		return nil, err
+	}
+
+	certSigner, err := withCertificate(signer, file+"-cert.pub")
+	if err != nil {
+		return nil, err
+	}
+
+	if certSigner != nil {
+		return []ssh.Signer{certSigner, signer}, nil
+	}
+
+	return []ssh.Signer{signer}, nil
+}
+
+// agent returns the client of the ssh agent at SSH_AUTH_SOCK or nil when
+// there is no agent. The connection is kept open until Close.
+func (a *Auth) agent() (agent.ExtendedAgent, error) {
+	a.agentMux.Lock()
+	defer a.agentMux.Unlock()
+
+	if a.agentClient != nil {
+		return a.agentClient, nil
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	a.agentConn = conn
+	a.agentClient = agent.NewClient(conn)
+	return a.agentClient, nil
+}
+
+// agentKeys returns the keys of the ssh agent or nil when there is no
+// agent.
+func (a *Auth) agentKeys() ([]*agent.Key, error) {
+	client, err := a.agent()
+	if err != nil || client == nil {
+		return nil, err
+	}
+
+	keys, err := client.List()
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// agentSigners returns the signers of the ssh agent. Agent errors are
+// logged so that the other keys are still offered.
+func (a *Auth) agentSigners() []ssh.Signer {
+	client, err := a.agent()
+	if err == nil && client != nil {
+		var signers []ssh.Signer
+		signers, err = client.Signers()
+		if err == nil {
+			return signers
+		}
+
+		a.Close()
+	}
+
+	if err != nil {
+		logs.Warnf("ssh agent unavailable, using key files: %v", err)
+	}
+
+	return nil
+}
+
+// Close closes the connection to the ssh agent. The agent is connected
+// again when the auth is used after it was closed.
+func (a *Auth) Close() error {
+	a.agentMux.Lock()
+	defer a.agentMux.Unlock()
+
+	a.agentClient = nil
+	if a.agentConn == nil {
+		return nil
+	}
+
+	err := a.agentConn.Close()
+	a.agentConn = nil
+	return err
+}
+
+// parseKey parses the private key and decrypts it with the passphrase
+// or the passphrase callback when it is encrypted.
+func (a *Auth) parseKey(name string, data []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+
+	passphrase := a.Passphrase
+	if len(passphrase) == 0 {
+		if a.PassphraseCallback == nil {
+			return nil, fmt.Errorf("%w %s", ErrPassphraseRequired, name)
+		}
+
+		passphrase, err = a.PassphraseCallback(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt key %s: %w", name, err)
+	}
+
+	return signer, nil
+}
+
+// withCertificate returns a signer for the certificate file of the key
+// or nil when there is no certificate file.
+func withCertificate(signer ssh.Signer, file string) (ssh.Signer, error) {
+	pub, err := readPublicKey(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", file)
+	}
+
+	return ssh.NewCertSigner(cert, signer)
+}
+
+func readPublicKey(file string) (ssh.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	return pub, err
+}
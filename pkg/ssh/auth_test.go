@@ -0,0 +1,171 @@
+package ssh_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/stretchr/testify/assert"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// connect connects to a server that only accepts the public key.
+func connect(t *testing.T, accept gossh.PublicKey, auth *ssh.Auth) error {
+	host, port := serveSftp(t, &gossh.ServerConfig{
+		PublicKeyCallback: func(c gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), accept.Marshal()) {
+				return nil, nil
+			}
+
+			return nil, errors.New("unknown key")
+		},
+	})
+
+	client, err := ssh.NewNativeClient("test", "", host, port, auth, 5*time.Second, gossh.InsecureIgnoreHostKey())
+	if err != nil {
+		return err
+	}
+
+	conn, info, err := client.(*ssh.NativeClient).Connect(5 * time.Second)
+	if err != nil {
+		return err
+	}
+
+	conn.Close()
+	info.CloseAll()
+	return nil
+}
+
+func writeEncryptedKey(t *testing.T, passphrase string) (string, gossh.PublicKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	block, err := gossh.MarshalPrivateKeyWithPassphrase(priv, "test", []byte(passphrase))
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(block), 0600))
+
+	key, err := gossh.NewPublicKey(pub)
+	assert.NoError(t, err)
+
+	return file, key
+}
+
+func TestAuthPassphrase(t *testing.T) {
+	file, pub := writeEncryptedKey(t, "secret")
+
+	err := connect(t, pub, &ssh.Auth{Keys: []string{file}})
+	assert.ErrorIs(t, err, ssh.ErrPassphraseRequired)
+
+	assert.NoError(t, connect(t, pub, &ssh.Auth{Keys: []string{file}, Passphrase: []byte("secret")}))
+
+	asked := ""
+	err = connect(t, pub, &ssh.Auth{
+		Keys: []string{file},
+		PassphraseCallback: func(name string) ([]byte, error) {
+			asked = name
+			return []byte("secret"), nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, file, asked)
+}
+
+func TestAuthAgent(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	keyring := agent.NewKeyring()
+	assert.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: priv}))
+
+	dir, err := os.MkdirTemp("", "agent")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", l.Addr().String())
+
+	key, err := gossh.NewPublicKey(pub)
+	assert.NoError(t, err)
+	assert.NoError(t, connect(t, key, &ssh.Auth{Agent: true}))
+}
+
+func TestAuthStaleAgent(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "missing.sock"))
+
+	file, pub := writeEncryptedKey(t, "secret")
+	assert.NoError(t, connect(t, pub, &ssh.Auth{Agent: true, Keys: []string{file}, Passphrase: []byte("secret")}))
+}
+
+func TestAuthSkipsEncryptedKey(t *testing.T) {
+	locked, _ := writeEncryptedKey(t, "other")
+	file, pub := writeEncryptedKey(t, "secret")
+
+	err := connect(t, pub, &ssh.Auth{
+		Keys: []string{locked, file},
+		PassphraseCallback: func(name string) ([]byte, error) {
+			if name == locked {
+				return nil, ssh.ErrPassphraseRequired
+			}
+			return []byte("secret"), nil
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestAuthCertificate(t *testing.T) {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	ca, err := gossh.NewSignerFromKey(caKey)
+	assert.NoError(t, err)
+
+	file, pub := writeEncryptedKey(t, "secret")
+	cert := &gossh.Certificate{
+		Key:             pub,
+		CertType:        gossh.UserCert,
+		ValidPrincipals: []string{"test"},
+		ValidBefore:     gossh.CertTimeInfinity,
+	}
+	assert.NoError(t, cert.SignCert(rand.Reader, ca))
+	assert.NoError(t, os.WriteFile(file+"-cert.pub", gossh.MarshalAuthorizedKey(cert), 0644))
+
+	checker := &gossh.CertChecker{
+		IsUserAuthority: func(auth gossh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+		},
+	}
+
+	host, port := serveSftp(t, &gossh.ServerConfig{PublicKeyCallback: checker.Authenticate})
+	client, err := ssh.NewNativeClient("test", "", host, port, &ssh.Auth{Keys: []string{file}, Passphrase: []byte("secret")}, 5*time.Second, gossh.InsecureIgnoreHostKey())
+	assert.NoError(t, err)
+
+	conn, info, err := client.(*ssh.NativeClient).Connect(5 * time.Second)
+	assert.NoError(t, err)
+	conn.Close()
+	info.CloseAll()
+}
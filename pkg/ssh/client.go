@@ -31,6 +31,7 @@ import (
 
 	"github.com/moby/term"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	terminal "golang.org/x/term"
 )
 
@@ -104,6 +105,18 @@ type Client interface {
 
 	// Stops cached sessions and close the connection
 	StopPersistentConn()
+
+	// Upload copies a local file to the host. Returns false when the
+	// remote file is unchanged.
+	Upload(local, remote string, opts *TransferOptions) (bool, error)
+
+	// Download copies a file from the host. Returns false when the
+	// local file is unchanged.
+	Download(remote, local string, opts *TransferOptions) (bool, error)
+
+	// SyncDir uploads a local directory to the host and returns the
+	// remote files that were written.
+	SyncDir(localDir, remoteDir string, opts *TransferOptions) ([]string, error)
 }
 
 type HostDetail struct {
@@ -133,6 +146,9 @@ type NativeClient struct {
 	connectedClientMux  sync.Mutex
 	SessionInfo         *SessionInfo
 	DefaultClientConfig *ssh.ClientConfig
+
+	// auths are closed with the client to close their agent connections.
+	auths []*Auth
 }
 
 // Auth contains auth info
@@ -142,6 +158,14 @@ type Auth struct {
 	RawKeys          [][]byte                  // RawKeys is a slice of private keys to try
 	KeyPairs         []KeyPair                 // KeyPairs is a slice of signed public keys & private keys to try
 	KeyPairsCallback func() ([]KeyPair, error) // Callback to get KeyPairs
+
+	Agent              bool                              // Agent uses the keys of the ssh agent at SSH_AUTH_SOCK
+	Passphrase         []byte                            // Passphrase decrypts encrypted keys
+	PassphraseCallback func(name string) ([]byte, error) // Callback to get the passphrase of an encrypted key e.g. PromptPassphrase
+
+	agentMux    sync.Mutex
+	agentConn   net.Conn
+	agentClient agent.ExtendedAgent
 }
 
 // Config is used to create new client.
@@ -152,7 +176,11 @@ type Config struct {
 	Port    int                 // port to connect to, 22 by default
 	Auth    *Auth               // authentication methods to use
 	Timeout time.Duration       // connect timeout, 30s by default
-	HostKey ssh.HostKeyCallback // callback for verifying server keys, ssh.InsecureIgnoreHostKey by default
+	HostKey ssh.HostKeyCallback // callback for verifying server keys, known hosts with the default host key mode by default
+
+	// HostKeyAlgorithms restricts the host keys the server may offer
+	// e.g. to the types known for the host, the ssh defaults when empty.
+	HostKeyAlgorithms []string
 }
 
 func (cfg *Config) version() string {
@@ -180,7 +208,13 @@ func (cfg *Config) hostKey() ssh.HostKeyCallback {
 	if cfg.HostKey != nil {
 		return cfg.HostKey
 	}
-	return ssh.InsecureIgnoreHostKey()
+	cb, err := NewHostKeyCallback(HostKeyOptions{})
+	if err != nil {
+		return func(string, net.Addr, ssh.PublicKey) error {
+			return err
+		}
+	}
+	return cb
 }
 
 // saves SSH client so it can be closed later
@@ -243,6 +277,7 @@ func (c *NativeClient) Copy() *NativeClient {
 		ClientVersion:       c.ClientVersion,
 		DefaultClientConfig: c.DefaultClientConfig,
 		SessionInfo:         &sessionInfo,
+		auths:               c.auths,
 	}
 	return &copyClient
 }
@@ -275,18 +310,67 @@ func (c *NativeClient) RemoveLastHop() (interface{}, error) {
 func NewClient(config *Config) (Client, error) {
 	defaultConfig, err := NewNativeConfig(config.User, config.version(), config.Auth, config.timeout(), config.hostKey())
 	if err != nil {
-		return nil, fmt.Errorf("Error getting host config for native Go SSH: %s", err)
+		return nil, fmt.Errorf("Error getting host config for native Go SSH: %w", err)
+	}
+	defaultConfig.HostKeyAlgorithms = config.HostKeyAlgorithms
+	return newClientWithAuth(config.Host, config.port(), defaultConfig, config.Auth)
+}
+
+// newClientWithAuth creates a client that closes the auth with it.
+func newClientWithAuth(host string, port int, config ssh.ClientConfig, auth *Auth) (Client, error) {
+	client, err := NewClientWithConfig(host, port, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth != nil {
+		nc := client.(*NativeClient)
+		nc.auths = append(nc.auths, auth)
 	}
-	return NewClientWithConfig(config.Host, config.port(), defaultConfig)
+
+	return client, nil
+}
+
+// NewClientWithJumps creates a client that connects to the host of the
+// config through the jump hosts in order e.g. a ProxyJump chain.
+func NewClientWithJumps(config *Config, jumps []*Config) (*NativeClient, error) {
+	hosts := append(append([]*Config{}, jumps...), config)
+	client, err := NewClient(hosts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	nc := client.(*NativeClient)
+	for _, h := range hosts[1:] {
+		cc, err := NewNativeConfig(h.User, h.version(), h.Auth, h.timeout(), h.hostKey())
+		if err != nil {
+			return nil, fmt.Errorf("Error getting host config for native Go SSH: %w", err)
+		}
+		cc.HostKeyAlgorithms = h.HostKeyAlgorithms
+
+		next, err := nc.AddHopWithConfig(h.Host, h.port(), &cc)
+		if err != nil {
+			return nil, err
+		}
+
+		nc = next.(*NativeClient)
+		if h.Auth != nil {
+			nc.auths = append(nc.auths, h.Auth)
+		}
+	}
+
+	// hops added later with AddHop use the config of the host.
+	nc.DefaultClientConfig = nc.HostDetails[len(nc.HostDetails)-1].ClientConfig
+	return nc, nil
 }
 
 // NewNativeClient creates a new Client using the golang ssh library
 func NewNativeClient(user, clientVersion string, host string, port int, hostAuth *Auth, timeout time.Duration, hostKeyCallback ssh.HostKeyCallback) (Client, error) {
 	defaultConfig, err := NewNativeConfig(user, clientVersion, hostAuth, timeout, hostKeyCallback)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting host config for native Go SSH: %s", err)
+		return nil, fmt.Errorf("Error getting host config for native Go SSH: %w", err)
 	}
-	return NewClientWithConfig(host, port, defaultConfig)
+	return newClientWithAuth(host, port, defaultConfig, hostAuth)
 }
 
 func NewClientWithConfig(host string, port int, config ssh.ClientConfig) (Client, error) {
@@ -302,7 +386,8 @@ func NewClientWithConfig(host string, port int, config ssh.ClientConfig) (Client
 	return &nc, nil
 }
 
-// NewNativeConfig returns a golang ssh client config struct for use by the NativeClient
+// NewNativeConfig returns a golang ssh client config struct for use by the NativeClient.
+// A nil hostKeyCallback checks host keys strictly against the known hosts files.
 func NewNativeConfig(user, clientVersion string, auth *Auth, timeout time.Duration, hostKeyCallback ssh.HostKeyCallback) (ssh.ClientConfig, error) {
 	var (
 		authMethods []ssh.AuthMethod
@@ -312,58 +397,21 @@ func NewNativeConfig(user, clientVersion string, auth *Auth, timeout time.Durati
 		clientVersion = "SSH-2.0-Go"
 	}
 	if auth != nil {
-		rawKeys := auth.RawKeys
-		for _, k := range auth.Keys {
-			key, err := os.ReadFile(k)
-			if err != nil {
-				return ssh.ClientConfig{}, err
-			}
-
-			rawKeys = append(rawKeys, key)
-		}
-
-		for _, key := range rawKeys {
-			privateKey, err := ssh.ParsePrivateKey(key)
-			if err != nil {
-				return ssh.ClientConfig{}, err
-			}
-
-			authMethods = append(authMethods, ssh.PublicKeys(privateKey))
-		}
-
-		for _, p := range auth.Passwords {
-			authMethods = append(authMethods, ssh.Password(p))
-		}
-
-		for _, keypair := range auth.KeyPairs {
-			signer, err := keypair.getSigner()
-			if err != nil {
-				return ssh.ClientConfig{}, err
-			}
-			authMethods = append(authMethods, ssh.PublicKeys(signer))
+		methods, err := auth.authMethods()
+		if err != nil {
+			return ssh.ClientConfig{}, err
 		}
 
-		if auth.KeyPairsCallback != nil {
-			authMethods = append(authMethods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
-				keypairs, err := auth.KeyPairsCallback()
-				if err != nil {
-					return nil, err
-				}
-				signers := []ssh.Signer{}
-				for _, keypair := range keypairs {
-					signer, err := keypair.getSigner()
-					if err != nil {
-						return nil, err
-					}
-					signers = append(signers, signer)
-				}
-				return signers, nil
-			}))
-		}
+		authMethods = methods
 	}
 
 	if hostKeyCallback == nil {
-		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+		cb, err := NewHostKeyCallback(HostKeyOptions{Mode: HostKeyStrict})
+		if err != nil {
+			return ssh.ClientConfig{}, err
+		}
+
+		hostKeyCallback = cb
 	}
 
 	return ssh.ClientConfig{
@@ -527,6 +575,9 @@ func (nc *NativeClient) StopPersistentConn() {
 	nc.connectedClientMux.Lock()
 	defer nc.connectedClientMux.Unlock()
 	nc.stopPersistentConn()
+	for _, a := range nc.auths {
+		a.Close()
+	}
 }
 
 // Output returns the output of the command run on the remote host.
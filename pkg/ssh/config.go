@@ -4,81 +4,243 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/jolt9dev/j9d/pkg/logs"
 	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
 )
 
-func FindConfig(alias string) error {
+var (
+	ErrConfigNotFound = errors.New("ssh config file does not exist")
+	ErrHostNotFound   = errors.New("host not found in ssh config file")
+)
+
+// HostConfig is a host resolved from an ssh config file.
+type HostConfig struct {
+	Alias              string
+	HostName           string
+	User               string
+	Port               int
+	IdentityFiles      []string
+	ProxyJump          []string
+	IdentitiesOnly     bool
+	UserKnownHostsFile []string
+}
+
+// JumpHost is a host of a ProxyJump chain e.g. user@host:port.
+type JumpHost struct {
+	User string
+	Host string
+	Port int
+}
+
+// FindConfig resolves the alias with ~/.ssh/config.
+func FindConfig(alias string) (*HostConfig, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	sshConfigFile := filepath.Join(home, ".ssh", "ssh_config")
+	return FindConfigFile(filepath.Join(home, ".ssh", "config"), alias)
+}
+
+// FindConfigFile resolves the alias with the ssh config file. Returns
+// ErrHostNotFound when no host other than "Host *" matches the alias.
+func FindConfigFile(file, alias string) (*HostConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrConfigNotFound
+		}
 
-	if _, err := os.Stat(sshConfigFile); os.IsNotExist(err) {
-		return errors.New("ssh config file does not exist")
+		return nil, err
 	}
 
-	sshConfigData, err := os.ReadFile(sshConfigFile)
+	cfg, err := ssh_config.DecodeBytes(data)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	found := false
+	for _, host := range cfg.Hosts {
+		for _, p := range host.Patterns {
+			if p.String() != "*" && host.Matches(alias) {
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return nil, ErrHostNotFound
+	}
+
+	hc := &HostConfig{Alias: alias, HostName: alias}
+	get := func(key string) string {
+		v, _ := cfg.Get(alias, key)
+		return v
+	}
+
+	if v := get("HostName"); v != "" {
+		hc.HostName = expandTokens(v, hc)
 	}
 
-	sshConfig, err := ssh_config.DecodeBytes(sshConfigData)
+	hc.User = get("User")
+	if v := get("Port"); v != "" {
+		hc.Port, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hc.IdentitiesOnly = strings.EqualFold(get("IdentitiesOnly"), "yes")
+
+	identities, err := cfg.GetAll(alias, "IdentityFile")
 	if err != nil {
-		return err
-	}
-
-	if sshConfig.Hosts == nil {
-		return errors.New("ssh config file does not contain any hosts")
-	}
-
-	hostFound := false
-
-	port := 22
-	hostname := alias
-	username := ""
-	identityFiles := []string{}
-	passwordAuth := false
-
-	for _, host := range sshConfig.Hosts {
-		if host.Matches(alias) {
-			hostFound = true
-			for _, n := range host.Nodes {
-				if kv, ok := n.(*ssh_config.KV); ok {
-					switch kv.Key {
-					case "HostName":
-						hostname = kv.Value
-					case "User":
-						username = kv.Value
-					case "Port":
-						portValue := kv.Value
-						port, err = strconv.Atoi(portValue)
-						if err != nil {
-							return err
-						}
-					case "IdentityFile":
-						identityFiles = append(identityFiles, kv.Value)
-					case "PasswordAuthentication":
-						passwordAuth = kv.Value == "yes"
-					}
-				}
-				break
+		return nil, err
+	}
+
+	for _, id := range identities {
+		hc.IdentityFiles = append(hc.IdentityFiles, expandTokens(id, hc))
+	}
+
+	if v := get("ProxyJump"); v != "" && !strings.EqualFold(v, "none") {
+		for _, j := range strings.Split(v, ",") {
+			if j = strings.TrimSpace(j); j != "" {
+				hc.ProxyJump = append(hc.ProxyJump, j)
 			}
 		}
 	}
 
-	println(port)
-	println(hostname)
-	println(username)
-	println(identityFiles)
-	println(passwordAuth)
+	for _, f := range strings.Fields(get("UserKnownHostsFile")) {
+		hc.UserKnownHostsFile = append(hc.UserKnownHostsFile, expandTokens(f, hc))
+	}
+
+	logs.Tracef("ssh config %s host=%s port=%d user=%s identity=%v jump=%v", alias, hc.HostName, hc.Port, hc.User, hc.IdentityFiles, hc.ProxyJump)
+
+	return hc, nil
+}
+
+// ParseJumpHost parses a ProxyJump entry e.g. user@host:port.
+func ParseJumpHost(s string) (JumpHost, error) {
+	j := JumpHost{}
+	s = strings.TrimPrefix(s, "ssh://")
+	if user, host, ok := strings.Cut(s, "@"); ok {
+		j.User = user
+		s = host
+	}
+
+	j.Host = s
+	if i := strings.LastIndex(s, ":"); i != -1 && !strings.HasSuffix(s, "]") {
+		port, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return j, err
+		}
+
+		j.Host = s[:i]
+		j.Port = port
+	}
+
+	j.Host = strings.TrimSuffix(strings.TrimPrefix(j.Host, "["), "]")
+	return j, nil
+}
+
+// Keys returns the identity files that exist. Unless IdentitiesOnly is
+// set, the default keys in ~/.ssh are added after the identity files.
+func (hc *HostConfig) Keys() []string {
+	keys := []string{}
+	for _, k := range hc.IdentityFiles {
+		if exists(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	if hc.IdentitiesOnly {
+		return keys
+	}
+
+	for _, k := range DefaultKeys() {
+		if !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// HostKeyCallback returns a callback that checks the host key against
+// the known hosts files of the host and the j9d known hosts file.
+func (hc *HostConfig) HostKeyCallback(mode HostKeyMode) (ssh.HostKeyCallback, error) {
+	return NewHostKeyCallback(HostKeyOptions{Mode: mode, Files: hc.UserKnownHostsFile})
+}
+
+// HostKeyAlgorithms returns the host key algorithms of the key types
+// known for the host, see KnownHostKeyAlgorithms.
+func (hc *HostConfig) HostKeyAlgorithms(mode HostKeyMode) ([]string, error) {
+	return KnownHostKeyAlgorithms(HostKeyOptions{Mode: mode, Files: hc.UserKnownHostsFile}, hc.HostName, hc.Port)
+}
+
+// DefaultKeys returns the default private keys in ~/.ssh that exist.
+func DefaultKeys() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	keys := []string{}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key := filepath.Join(home, ".ssh", name)
+		if exists(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// ExpandHome replaces a leading ~ with the home directory.
+func ExpandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
 
-	if !hostFound {
-		return errors.New("host not found in ssh config file")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
 	}
 
-	return nil
+	return filepath.Join(home, p[1:])
+}
+
+// expandTokens expands ~ and the %d, %h, %r, %u and %% tokens used in
+// ssh config paths.
+func expandTokens(s string, hc *HostConfig) string {
+	s = ExpandHome(s)
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	home, _ := os.UserHomeDir()
+	user := hc.User
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+
+	r := strings.NewReplacer(
+		"%%", "%",
+		"%d", home,
+		"%h", hc.HostName,
+		"%n", hc.Alias,
+		"%r", user,
+		"%u", os.Getenv("USER"),
+	)
+
+	return r.Replace(s)
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
 }
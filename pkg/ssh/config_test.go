@@ -0,0 +1,71 @@
+package ssh_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+const sshConfig = `
+Host prod-db
+    HostName 10.0.0.5
+    User deploy
+    Port 2222
+    IdentityFile ~/.ssh/prod
+    IdentityFile ~/.ssh/id_%h
+    IdentitiesOnly yes
+    ProxyJump bastion,admin@gw:2200
+    UserKnownHostsFile ~/.ssh/known_hosts ~/.ssh/prod_hosts
+
+Host bastion
+    HostName bastion.example.com
+
+Host *
+    User fallback
+`
+
+func TestFindConfigFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	file := filepath.Join(home, "config")
+	assert.NoError(t, os.WriteFile(file, []byte(sshConfig), 0600))
+
+	hc, err := ssh.FindConfigFile(file, "prod-db")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", hc.HostName)
+	assert.Equal(t, "deploy", hc.User)
+	assert.Equal(t, 2222, hc.Port)
+	assert.Equal(t, []string{filepath.Join(home, ".ssh", "prod"), filepath.Join(home, ".ssh", "id_10.0.0.5")}, hc.IdentityFiles)
+	assert.True(t, hc.IdentitiesOnly)
+	assert.Equal(t, []string{"bastion", "admin@gw:2200"}, hc.ProxyJump)
+	assert.Equal(t, []string{filepath.Join(home, ".ssh", "known_hosts"), filepath.Join(home, ".ssh", "prod_hosts")}, hc.UserKnownHostsFile)
+
+	hc, err = ssh.FindConfigFile(file, "bastion")
+	assert.NoError(t, err)
+	assert.Equal(t, "bastion.example.com", hc.HostName)
+	assert.Equal(t, "fallback", hc.User)
+	assert.Empty(t, hc.ProxyJump)
+
+	_, err = ssh.FindConfigFile(file, "unknown")
+	assert.ErrorIs(t, err, ssh.ErrHostNotFound)
+
+	_, err = ssh.FindConfigFile(filepath.Join(home, "missing"), "prod-db")
+	assert.ErrorIs(t, err, ssh.ErrConfigNotFound)
+}
+
+func TestParseJumpHost(t *testing.T) {
+	j, err := ssh.ParseJumpHost("admin@gw:2200")
+	assert.NoError(t, err)
+	assert.Equal(t, ssh.JumpHost{User: "admin", Host: "gw", Port: 2200}, j)
+
+	j, err = ssh.ParseJumpHost("bastion")
+	assert.NoError(t, err)
+	assert.Equal(t, ssh.JumpHost{Host: "bastion"}, j)
+
+	j, err = ssh.ParseJumpHost("[::1]:22")
+	assert.NoError(t, err)
+	assert.Equal(t, ssh.JumpHost{Host: "::1", Port: 22}, j)
+}
@@ -0,0 +1,308 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/jolt9dev/j9d/pkg/paths"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyMode is how host keys are checked against the known hosts files.
+type HostKeyMode string
+
+const (
+	// HostKeyStrict rejects hosts that are not in a known hosts file.
+	HostKeyStrict HostKeyMode = "strict"
+
+	// HostKeyAcceptNew adds unknown hosts to the j9d known hosts file
+	// and rejects hosts with a changed key.
+	HostKeyAcceptNew HostKeyMode = "accept-new"
+
+	// HostKeyOff does not check host keys.
+	HostKeyOff HostKeyMode = "off"
+)
+
+var (
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+	ErrHostKeyUnknown  = errors.New("host key is unknown")
+
+	defaultHostKeyMode = HostKeyAcceptNew
+	knownHostsMu       sync.Mutex
+)
+
+// ParseHostKeyMode parses the mode. The values of StrictHostKeyChecking
+// e.g. yes and no are accepted as well. An empty value returns the
+// default mode.
+func ParseHostKeyMode(s string) (HostKeyMode, error) {
+	switch s {
+	case "":
+		return defaultHostKeyMode, nil
+	case "strict", "yes":
+		return HostKeyStrict, nil
+	case "accept-new":
+		return HostKeyAcceptNew, nil
+	case "off", "no":
+		return HostKeyOff, nil
+	}
+
+	return "", fmt.Errorf("unknown host key mode %q, use strict, accept-new or off", s)
+}
+
+// SetHostKeyMode sets the mode used by hosts without a mode.
+func SetHostKeyMode(mode HostKeyMode) {
+	defaultHostKeyMode = mode
+}
+
+// DefaultHostKeyMode returns the mode used by hosts without a mode.
+func DefaultHostKeyMode() HostKeyMode {
+	return defaultHostKeyMode
+}
+
+// KnownHostsFile returns the known hosts file managed by j9d.
+func KnownHostsFile() (string, error) {
+	dir, err := paths.DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "known_hosts"), nil
+}
+
+// HostKeyOptions configure NewHostKeyCallback.
+type HostKeyOptions struct {
+	Mode HostKeyMode
+
+	// Files are the user known hosts files. ~/.ssh/known_hosts by default.
+	Files []string
+
+	// ManagedFile is the known hosts file that new hosts are added to.
+	// KnownHostsFile() by default.
+	ManagedFile string
+}
+
+// NewHostKeyCallback returns a callback that checks host keys against
+// the user known hosts files and the j9d known hosts file.
+func NewHostKeyCallback(opts HostKeyOptions) (ssh.HostKeyCallback, error) {
+	if opts.Mode == "" {
+		opts.Mode = defaultHostKeyMode
+	}
+
+	if opts.Mode == HostKeyOff {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	known, managed, err := opts.knownHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	// keys accepted by this callback, since the known hosts files are
+	// only read once.
+	accepted := map[string]ssh.PublicKey{}
+	mu := sync.Mutex{}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host := knownhosts.Normalize(hostname)
+		mu.Lock()
+		defer mu.Unlock()
+
+		if k, ok := accepted[host]; ok {
+			if string(k.Marshal()) == string(key.Marshal()) {
+				return nil
+			}
+
+			if k.Type() == key.Type() {
+				return fmt.Errorf("%w for %s: server sent %s %s, expected %s %s", ErrHostKeyMismatch, hostname,
+					key.Type(), Fingerprint(key), k.Type(), Fingerprint(k))
+			}
+
+			return fmt.Errorf("%w for %s: %s %s is not in a known hosts file, known types are %s", ErrHostKeyUnknown, hostname,
+				key.Type(), Fingerprint(key), k.Type())
+		}
+
+		if known != nil {
+			err := known(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) {
+				return err
+			}
+
+			// a key of another type is not a changed key, the host is
+			// only unknown with this type.
+			for _, want := range keyErr.Want {
+				if want.Key.Type() == key.Type() {
+					return fmt.Errorf("%w for %s: server sent %s %s, expected %s %s from %s:%d", ErrHostKeyMismatch, hostname,
+						key.Type(), Fingerprint(key), want.Key.Type(), Fingerprint(want.Key), want.Filename, want.Line)
+				}
+			}
+
+			if len(keyErr.Want) > 0 {
+				return fmt.Errorf("%w for %s: %s %s is not in a known hosts file, known types are %s", ErrHostKeyUnknown, hostname,
+					key.Type(), Fingerprint(key), strings.Join(keyTypes(keyErr.Want), ", "))
+			}
+		}
+
+		if opts.Mode == HostKeyStrict {
+			return fmt.Errorf("%w for %s: %s %s is not in a known hosts file", ErrHostKeyUnknown, hostname,
+				key.Type(), Fingerprint(key))
+		}
+
+		err := addKnownHost(managed, host, key)
+		if err != nil {
+			return err
+		}
+
+		accepted[host] = key
+		logs.Warnf("added %s %s for %s to %s", key.Type(), Fingerprint(key), hostname, managed)
+		return nil
+	}, nil
+}
+
+// knownHosts returns the callback of the known hosts files that exist,
+// nil when there are none, and the managed known hosts file.
+func (opts HostKeyOptions) knownHosts() (ssh.HostKeyCallback, string, error) {
+	files := opts.Files
+	if len(files) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, "", err
+		}
+
+		files = []string{filepath.Join(home, ".ssh", "known_hosts")}
+	}
+
+	managed := opts.ManagedFile
+	if managed == "" {
+		f, err := KnownHostsFile()
+		if err != nil {
+			return nil, "", err
+		}
+
+		managed = f
+	}
+
+	existing := []string{}
+	for _, f := range append(files, managed) {
+		if exists(f) {
+			existing = append(existing, f)
+		}
+	}
+
+	if len(existing) == 0 {
+		return nil, managed, nil
+	}
+
+	known, err := knownhosts.New(existing...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return known, managed, nil
+}
+
+// KnownHostKeyAlgorithms returns the host key algorithms of the key
+// types known for the host so that the server offers a key that is in
+// the known hosts files. Nil is returned for unknown hosts and with
+// HostKeyOff, which leaves the algorithms to the ssh defaults.
+func KnownHostKeyAlgorithms(opts HostKeyOptions, host string, port int) ([]string, error) {
+	if opts.Mode == "" {
+		opts.Mode = defaultHostKeyMode
+	}
+
+	if opts.Mode == HostKeyOff {
+		return nil, nil
+	}
+
+	known, _, err := opts.knownHosts()
+	if err != nil || known == nil {
+		return nil, err
+	}
+
+	if port == 0 {
+		port = 22
+	}
+
+	// the known keys of the host are returned in the error for a key
+	// that is not known.
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	err = known(addr, &net.TCPAddr{IP: net.IPv4zero, Port: port}, probe)
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil, nil
+	}
+
+	algos := []string{}
+	for _, t := range keyTypes(keyErr.Want) {
+		if t == ssh.KeyAlgoRSA {
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+
+		algos = append(algos, t)
+	}
+
+	if len(algos) == 0 {
+		return nil, nil
+	}
+
+	return algos, nil
+}
+
+// keyTypes returns the sorted key types of the known keys.
+func keyTypes(keys []knownhosts.KnownKey) []string {
+	types := []string{}
+	for _, k := range keys {
+		types = append(types, k.Key.Type())
+	}
+
+	sort.Strings(types)
+	return types
+}
+
+func addKnownHost(file, host string, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(knownhosts.Line([]string{host}, key) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
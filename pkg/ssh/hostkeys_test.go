@@ -0,0 +1,107 @@
+package ssh_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/stretchr/testify/assert"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newHostKey(t *testing.T) gossh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	key, err := gossh.NewPublicKey(pub)
+	assert.NoError(t, err)
+
+	return key
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "known_hosts")
+	managed := filepath.Join(dir, "j9d", "known_hosts")
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 22}
+
+	known := newHostKey(t)
+	assert.NoError(t, os.WriteFile(user, []byte(knownhosts.Line([]string{"prod"}, known)+"\n"), 0600))
+
+	strict, err := ssh.NewHostKeyCallback(ssh.HostKeyOptions{Mode: ssh.HostKeyStrict, Files: []string{user}, ManagedFile: managed})
+	assert.NoError(t, err)
+	assert.NoError(t, strict("prod:22", addr, known))
+
+	other := newHostKey(t)
+	err = strict("prod:22", addr, other)
+	assert.ErrorIs(t, err, ssh.ErrHostKeyMismatch)
+	assert.Contains(t, err.Error(), ssh.Fingerprint(other))
+	assert.Contains(t, err.Error(), ssh.Fingerprint(known))
+
+	err = strict("new:22", addr, other)
+	assert.ErrorIs(t, err, ssh.ErrHostKeyUnknown)
+	assert.NoFileExists(t, managed)
+
+	acceptNew, err := ssh.NewHostKeyCallback(ssh.HostKeyOptions{Mode: ssh.HostKeyAcceptNew, Files: []string{user}, ManagedFile: managed})
+	assert.NoError(t, err)
+	assert.NoError(t, acceptNew("new:22", addr, other))
+	assert.ErrorIs(t, acceptNew("new:22", addr, known), ssh.ErrHostKeyMismatch)
+	assert.ErrorIs(t, acceptNew("prod:22", addr, other), ssh.ErrHostKeyMismatch)
+
+	// the accepted key is read back from the j9d known hosts file.
+	strict, err = ssh.NewHostKeyCallback(ssh.HostKeyOptions{Mode: ssh.HostKeyStrict, Files: []string{user}, ManagedFile: managed})
+	assert.NoError(t, err)
+	assert.NoError(t, strict("new:22", addr, other))
+
+	off, err := ssh.NewHostKeyCallback(ssh.HostKeyOptions{Mode: ssh.HostKeyOff})
+	assert.NoError(t, err)
+	assert.NoError(t, off("prod:22", addr, other))
+}
+
+func TestHostKeyOtherType(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "known_hosts")
+	managed := filepath.Join(dir, "j9d", "known_hosts")
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2222}
+
+	known := newHostKey(t)
+	assert.NoError(t, os.WriteFile(user, []byte(knownhosts.Line([]string{"[prod]:2222"}, known)+"\n"), 0600))
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	other, err := gossh.NewPublicKey(&rsaKey.PublicKey)
+	assert.NoError(t, err)
+
+	strict, err := ssh.NewHostKeyCallback(ssh.HostKeyOptions{Mode: ssh.HostKeyStrict, Files: []string{user}, ManagedFile: managed})
+	assert.NoError(t, err)
+	err = strict("prod:2222", addr, other)
+	assert.ErrorIs(t, err, ssh.ErrHostKeyUnknown)
+	assert.NotErrorIs(t, err, ssh.ErrHostKeyMismatch)
+
+	algos, err := ssh.KnownHostKeyAlgorithms(ssh.HostKeyOptions{Mode: ssh.HostKeyStrict, Files: []string{user}, ManagedFile: managed}, "prod", 2222)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{gossh.KeyAlgoED25519}, algos)
+
+	algos, err = ssh.KnownHostKeyAlgorithms(ssh.HostKeyOptions{Mode: ssh.HostKeyStrict, Files: []string{user}, ManagedFile: managed}, "new", 22)
+	assert.NoError(t, err)
+	assert.Nil(t, algos)
+}
+
+func TestParseHostKeyMode(t *testing.T) {
+	mode, err := ssh.ParseHostKeyMode("yes")
+	assert.NoError(t, err)
+	assert.Equal(t, ssh.HostKeyStrict, mode)
+
+	mode, err = ssh.ParseHostKeyMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, ssh.DefaultHostKeyMode(), mode)
+
+	_, err = ssh.ParseHostKeyMode("maybe")
+	assert.Error(t, err)
+}
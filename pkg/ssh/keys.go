@@ -5,11 +5,9 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"runtime"
 
@@ -94,10 +92,19 @@ func (kp *KeyPair) WriteToFile(privateKeyPath string, publicKeyPath string) erro
 
 // Fingerprint calculates the fingerprint of the public key
 func (kp *KeyPair) Fingerprint() string {
-	b, _ := base64.StdEncoding.DecodeString(string(kp.PublicKey))
+	pub, _, _, _, err := gossh.ParseAuthorizedKey(kp.PublicKey)
+	if err != nil {
+		return ""
+	}
+
+	return Fingerprint(pub)
+}
+
+// Fingerprint calculates the md5 fingerprint of the public key
+func Fingerprint(key gossh.PublicKey) string {
 	h := md5.New()
 
-	io.WriteString(h, string(b))
+	h.Write(key.Marshal())
 
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
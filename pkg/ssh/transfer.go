@@ -0,0 +1,482 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/logs"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// TransferOptions control how files are transferred by Upload,
+// Download and SyncDir.
+type TransferOptions struct {
+	// Mode is the mode of the written file. When zero, the mode of the
+	// source file is used.
+	Mode os.FileMode
+
+	// Chown sets the owner of the written file to Uid and Gid.
+	Chown bool
+	Uid   int
+	Gid   int
+
+	// Force writes the file even when the checksum of the destination
+	// matches the source.
+	Force bool
+
+	// Delete removes files from the destination directory that are not
+	// in the source directory. Only used by SyncDir.
+	Delete bool
+}
+
+// Upload copies the local file to the remote path over sftp. The file
+// is written to a temp file next to the remote path and renamed over
+// it, so readers never see a partial file. Returns false when the
+// remote file already has the same checksum.
+func (client *NativeClient) Upload(local, remote string, opts *TransferOptions) (bool, error) {
+	t, done, err := client.sftp()
+	if err != nil {
+		return false, err
+	}
+
+	defer done()
+
+	return t.upload(local, remote, opts)
+}
+
+// Download copies the remote file to the local path over sftp. The
+// file is written to a temp file and renamed over the local path.
+// Returns false when the local file already has the same checksum.
+func (client *NativeClient) Download(remote, local string, opts *TransferOptions) (bool, error) {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+
+	t, done, err := client.sftp()
+	if err != nil {
+		return false, err
+	}
+
+	defer done()
+
+	sc := t.sc
+	fi, err := sc.Stat(remote)
+	if err != nil {
+		return false, err
+	}
+
+	mode := opts.Mode
+	if mode == 0 {
+		mode = fi.Mode().Perm()
+	}
+
+	if !opts.Force {
+		if lfi, err := os.Stat(local); err == nil {
+			same, err := t.unchanged(local, lfi, remote, fi)
+			if err != nil {
+				return false, err
+			}
+
+			if same {
+				// the owner and mode are applied even when the
+				// content is unchanged.
+				if lfi.Mode().Perm() != mode {
+					err = os.Chmod(local, mode)
+					if err != nil {
+						return false, err
+					}
+				}
+
+				if opts.Chown {
+					return false, os.Chown(local, opts.Uid, opts.Gid)
+				}
+
+				return false, nil
+			}
+		}
+	}
+
+	src, err := sc.Open(remote)
+	if err != nil {
+		return false, err
+	}
+
+	defer src.Close()
+
+	dir := filepath.Dir(local)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(local)+".*.tmp")
+	if err != nil {
+		return false, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	// the mtime is compared when the remote file can not be hashed.
+	err = os.Chtimes(tmp.Name(), time.Now(), fi.ModTime())
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return false, err
+	}
+
+	if opts.Chown {
+		err = os.Chown(tmp.Name(), opts.Uid, opts.Gid)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, os.Rename(tmp.Name(), local)
+}
+
+// SyncDir uploads every file in the local directory to the remote
+// directory, skipping files that are unchanged. Returns the remote
+// paths of the files that were written.
+func (client *NativeClient) SyncDir(localDir, remoteDir string, opts *TransferOptions) ([]string, error) {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+
+	t, done, err := client.sftp()
+	if err != nil {
+		return nil, err
+	}
+
+	defer done()
+
+	sc := t.sc
+	root := path.Clean(remoteDir)
+	written := []string{}
+	seen := map[string]bool{}
+	err = filepath.Walk(localDir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+
+		remote := path.Join(root, filepath.ToSlash(rel))
+		seen[remote] = true
+		if fi.IsDir() {
+			return sc.MkdirAll(remote)
+		}
+
+		ok, err := t.upload(p, remote, opts)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			written = append(written, remote)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return written, err
+	}
+
+	if !opts.Delete {
+		return written, nil
+	}
+
+	// remove files before their directories.
+	stale := []string{}
+	walker := sc.Walk(root)
+	for walker.Step() {
+		if walker.Err() != nil {
+			return written, walker.Err()
+		}
+
+		// the paths of the walker are compared cleaned, and the root
+		// itself is never removed.
+		p := path.Clean(walker.Path())
+		if p != root && !seen[p] {
+			stale = append(stale, p)
+		}
+	}
+
+	for i := len(stale) - 1; i >= 0; i-- {
+		err = sc.RemoveAll(stale[i])
+		if err != nil && !os.IsNotExist(err) {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// transfer is an sftp client and the ssh connection it runs on, which
+// is used to hash remote files without reading them over sftp.
+type transfer struct {
+	sc   *sftp.Client
+	conn *ssh.Client
+
+	// noHash is set when sha256sum can not be run on the remote host.
+	noHash bool
+}
+
+// sftp opens an sftp client using the persistent connection when it
+// is started or a new connection through the host details otherwise.
+func (client *NativeClient) sftp() (*transfer, func(), error) {
+	if client.connectedClient != nil {
+		sc, err := sftp.NewClient(client.connectedClient)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &transfer{sc: sc, conn: client.connectedClient}, func() { sc.Close() }, nil
+	}
+
+	conn, sessionInfo, err := client.Connect(client.DefaultClientConfig.Timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sc, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		sessionInfo.CloseAll()
+		return nil, nil, err
+	}
+
+	return &transfer{sc: sc, conn: conn}, func() {
+		sc.Close()
+		conn.Close()
+		sessionInfo.CloseAll()
+	}, nil
+}
+
+// unchanged returns true when the local and remote files have the same
+// content. The remote file is hashed with sha256sum on the remote host,
+// and when that is not possible, files with the same size and mtime are
+// treated as unchanged.
+func (t *transfer) unchanged(local string, lfi os.FileInfo, remote string, rfi os.FileInfo) (bool, error) {
+	if lfi.Size() != rfi.Size() {
+		return false, nil
+	}
+
+	sum, ok := t.remoteChecksum(remote)
+	if !ok {
+		return lfi.ModTime().Unix() == rfi.ModTime().Unix(), nil
+	}
+
+	lsum, err := checksum(func() (io.ReadCloser, error) { return os.Open(local) })
+	if err != nil {
+		return false, err
+	}
+
+	return lsum == sum, nil
+}
+
+// remoteChecksum returns the sha256 checksum of the remote file computed
+// by sha256sum in a session. Returns false when it can not be computed.
+func (t *transfer) remoteChecksum(remote string) (string, bool) {
+	if t.noHash || t.conn == nil {
+		return "", false
+	}
+
+	session, err := t.conn.NewSession()
+	if err != nil {
+		logs.Debugf("unable to hash %s on the remote host: %v", remote, err)
+		t.noHash = true
+		return "", false
+	}
+
+	defer session.Close()
+
+	out, err := session.Output("sha256sum " + ShellQuote(remote))
+	if err != nil {
+		logs.Debugf("unable to hash %s on the remote host: %v", remote, err)
+
+		// only a failure of the file itself keeps hashing the others.
+		var exitErr *ssh.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitStatus() == 127 {
+			t.noHash = true
+		}
+
+		return "", false
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		t.noHash = true
+		return "", false
+	}
+
+	return strings.ToLower(fields[0]), true
+}
+
+// ShellQuote quotes the value for posix shells.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func (t *transfer) upload(local, remote string, opts *TransferOptions) (bool, error) {
+	sc := t.sc
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+
+	fi, err := os.Stat(local)
+	if err != nil {
+		return false, err
+	}
+
+	if fi.IsDir() {
+		return false, fmt.Errorf("%s is a directory", local)
+	}
+
+	mode := opts.Mode
+	if mode == 0 {
+		mode = fi.Mode().Perm()
+	}
+
+	if !opts.Force {
+		if rfi, err := sc.Stat(remote); err == nil {
+			same, err := t.unchanged(local, fi, remote, rfi)
+			if err != nil {
+				return false, err
+			}
+
+			if same {
+				// the owner and mode are applied even when the
+				// content is unchanged.
+				if rfi.Mode().Perm() != mode {
+					err = sc.Chmod(remote, mode)
+					if err != nil {
+						return false, err
+					}
+				}
+
+				if opts.Chown {
+					return false, sc.Chown(remote, opts.Uid, opts.Gid)
+				}
+
+				return false, nil
+			}
+		}
+	}
+
+	src, err := os.Open(local)
+	if err != nil {
+		return false, err
+	}
+
+	defer src.Close()
+
+	dir := path.Dir(remote)
+	err = sc.MkdirAll(dir)
+	if err != nil {
+		return false, err
+	}
+
+	suffix := make([]byte, 6)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		return false, err
+	}
+
+	tmp := path.Join(dir, fmt.Sprintf(".%s.%s.tmp", path.Base(remote), hex.EncodeToString(suffix)))
+	dst, err := sc.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return false, err
+	}
+
+	// the mode is set before the content is written so it is never
+	// readable with the default mode of the server.
+	err = dst.Chmod(mode)
+	if err == nil {
+		_, err = io.Copy(dst, src)
+	}
+
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	// the mtime is compared when the remote file can not be hashed.
+	if err == nil {
+		err = sc.Chtimes(tmp, time.Now(), fi.ModTime())
+	}
+
+	if err == nil && opts.Chown {
+		err = sc.Chown(tmp, opts.Uid, opts.Gid)
+	}
+
+	if err == nil {
+		err = rename(sc, tmp, remote)
+	}
+
+	if err != nil {
+		sc.Remove(tmp)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// rename replaces the remote file using the posix-rename extension when
+// the server supports it.
+func rename(sc *sftp.Client, from, to string) error {
+	if _, ok := sc.HasExtension("posix-rename@openssh.com"); ok {
+		return sc.PosixRename(from, to)
+	}
+
+	err := sc.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+
+	if rerr := sc.Remove(to); rerr != nil && !os.IsNotExist(rerr) && !strings.Contains(rerr.Error(), "not exist") {
+		return err
+	}
+
+	return sc.Rename(from, to)
+}
+
+func checksum(open func() (io.ReadCloser, error)) (string, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,254 @@
+package ssh_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/ssh"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// serveSftp starts an ssh server on localhost that only serves the
+// sftp subsystem. Any password is accepted without a config.
+func serveSftp(t *testing.T, config *gossh.ServerConfig) (string, int) {
+	return serve(t, config, false)
+}
+
+// serve starts an ssh server on localhost that serves the sftp
+// subsystem and runs exec requests with sh when exec is true.
+func serve(t *testing.T, config *gossh.ServerConfig, exec bool) (string, int) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	signer, err := gossh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+
+	if config == nil {
+		config = &gossh.ServerConfig{
+			PasswordCallback: func(c gossh.ConnMetadata, pass []byte) (*gossh.Permissions, error) {
+				return nil, nil
+			},
+		}
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go handleConn(conn, config, exec)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+func handleConn(conn net.Conn, config *gossh.ServerConfig, exec bool) {
+	_, chans, reqs, err := gossh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+
+	go gossh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(gossh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				if exec && req.Type == "exec" {
+					req.Reply(true, nil)
+					cmd := osexec.Command("sh", "-c", string(req.Payload[4:]))
+					cmd.Stdout = ch
+					cmd.Stderr = ch.Stderr()
+					status := uint32(0)
+					if err := cmd.Run(); err != nil {
+						status = 1
+					}
+
+					ch.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{status}))
+					ch.Close()
+					continue
+				}
+
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(ch)
+					if err == nil {
+						server.Serve()
+					}
+
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+func newClient(t *testing.T) *ssh.NativeClient {
+	return newExecClient(t, false)
+}
+
+func newExecClient(t *testing.T, exec bool) *ssh.NativeClient {
+	host, port := serve(t, nil, exec)
+	client, err := ssh.NewClient(&ssh.Config{
+		User:    "test",
+		Host:    host,
+		Port:    port,
+		Auth:    &ssh.Auth{Passwords: []string{"test"}},
+		HostKey: gossh.InsecureIgnoreHostKey(),
+		Timeout: 5 * time.Second,
+	})
+	assert.NoError(t, err)
+
+	return client.(*ssh.NativeClient)
+}
+
+func TestUpload(t *testing.T) {
+	client := newClient(t)
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local.env")
+	remote := filepath.Join(dir, "remote", "app.env")
+	assert.NoError(t, os.WriteFile(local, []byte("A=1\n"), 0644))
+
+	ok, err := client.Upload(local, remote, &ssh.TransferOptions{Mode: 0600})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	data, err := os.ReadFile(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, "A=1\n", string(data))
+
+	fi, err := os.Stat(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	ok, err = client.Upload(local, remote, &ssh.TransferOptions{Mode: 0600})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	entries, err := os.ReadDir(filepath.Dir(remote))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestDownload(t *testing.T) {
+	client := newClient(t)
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.env")
+	local := filepath.Join(dir, "local", "app.env")
+	assert.NoError(t, os.WriteFile(remote, []byte("B=2\n"), 0640))
+
+	ok, err := client.Download(remote, local, nil)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	data, err := os.ReadFile(local)
+	assert.NoError(t, err)
+	assert.Equal(t, "B=2\n", string(data))
+
+	ok, err = client.Download(remote, local, nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSyncDir(t *testing.T) {
+	client := newClient(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "conf"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "conf", "b.txt"), []byte("b"), 0644))
+	assert.NoError(t, os.MkdirAll(dest, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dest, "stale.txt"), []byte("old"), 0644))
+
+	written, err := client.SyncDir(src, dest, &ssh.TransferOptions{Delete: true})
+	assert.NoError(t, err)
+	assert.Len(t, written, 2)
+	assert.FileExists(t, filepath.Join(dest, "conf", "b.txt"))
+	assert.NoFileExists(t, filepath.Join(dest, "stale.txt"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("changed"), 0644))
+	written, err = client.SyncDir(src, dest, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dest, "a.txt")}, written)
+}
+
+func TestUploadChecksum(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local.env")
+	remote := filepath.Join(dir, "remote.env")
+	mtime := time.Now().Add(-time.Hour)
+	for _, f := range []string{local, remote} {
+		assert.NoError(t, os.WriteFile(f, []byte("A=1\n"), 0644))
+	}
+
+	// same size and mtime with another content is only found by the
+	// checksum of the remote file.
+	assert.NoError(t, os.WriteFile(remote, []byte("A=2\n"), 0600))
+	assert.NoError(t, os.Chtimes(local, mtime, mtime))
+	assert.NoError(t, os.Chtimes(remote, mtime, mtime))
+
+	ok, err := newClient(t).Upload(local, remote, nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// the mode is applied to the unchanged file.
+	fi, err := os.Stat(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+
+	ok, err = newExecClient(t, true).Upload(local, remote, nil)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	data, err := os.ReadFile(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, "A=1\n", string(data))
+
+	ok, err = newExecClient(t, true).Upload(local, remote, nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSyncDirTrailingSlash(t *testing.T) {
+	client := newClient(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644))
+
+	for _, remote := range []string{dest + "/", dest + "/./"} {
+		_, err := client.SyncDir(src, remote, &ssh.TransferOptions{Delete: true})
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dest, "a.txt"))
+	}
+}
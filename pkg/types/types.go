@@ -3,13 +3,17 @@ package types
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jolt9dev/j9d/pkg/consts"
 	"github.com/jolt9dev/j9d/pkg/paths"
+	"github.com/jolt9dev/j9d/pkg/ssh"
 	fs "github.com/jolt9dev/j9d/pkg/xfs"
 	"gopkg.in/yaml.v3"
 )
@@ -147,11 +151,243 @@ type Jolt9 struct {
 	Ssh      *Ssh              `json:"ssh,omitempty" yaml:"ssh,omitempty"`
 }
 
+// TargetFileName returns the name of the j9d file that overrides the
+// j9d.yaml file for the target e.g. prod -> prod.j9d.yaml.
+func TargetFileName(target string) string {
+	return target + ".j9d.yaml"
+}
+
+// FindTargetFile returns the <target>.j9d.yaml or <target>.j9d.yml file
+// in the directory, or the j9d.yaml or j9d.yml file for the default
+// target. The .yaml name is returned when neither exists.
+func FindTargetFile(dir, target string) (string, bool) {
+	name := "j9d"
+	if target != "" && target != "default" {
+		name = target + ".j9d"
+	}
+
+	for _, ext := range []string{".yaml", ".yml"} {
+		file := filepath.Join(dir, name+ext)
+		if fs.Exists(file) {
+			return file, true
+		}
+	}
+
+	return filepath.Join(dir, name+".yaml"), false
+}
+
 type Ssh struct {
 	Host     string `json:"host" yaml:"host"`
 	Port     int    `json:"port" yaml:"port"`
 	User     string `json:"user" yaml:"user"`
 	Identity string `json:"identity" yaml:"identity"`
+
+	// HostKeyCheck is strict, accept-new or off. The global
+	// --host-key-check flag is used when empty.
+	HostKeyCheck string `json:"host-key-check,omitempty" yaml:"host-key-check,omitempty"`
+
+	// Passphrase decrypts an encrypted identity, usually a secret
+	// e.g. ${SSH_PASSPHRASE}. Without it, the passphrase is prompted for
+	// unless the key is in the ssh agent.
+	Passphrase string `json:"passphrase,omitempty" yaml:"passphrase,omitempty"`
+
+	// ssh driver options used when there is no compose block.
+	Dir    string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Deploy []Task `json:"deploy,omitempty" yaml:"deploy,omitempty"`
+	Remove []Task `json:"remove,omitempty" yaml:"remove,omitempty"`
+	Status []Task `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// Resolve returns a copy of the ssh block with the connection details
+// of a named host from the global config e.g. host: "@prod-1". Values
+// set on the block take precedence.
+func (s *Ssh) Resolve() (*Ssh, error) {
+	r := *s
+	if !strings.HasPrefix(s.Host, "@") {
+		return &r, nil
+	}
+
+	cfg, err := GetGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	h, ok := cfg.Host(s.Host)
+	if !ok {
+		return nil, fmt.Errorf("host %s not found in the global config", s.Host)
+	}
+
+	r.Host = h.Host
+	if r.Port == 0 {
+		r.Port = h.Port
+	}
+
+	if r.User == "" {
+		r.User = h.User
+	}
+
+	if r.Identity == "" {
+		r.Identity = h.Identity
+	}
+
+	if r.HostKeyCheck == "" {
+		r.HostKeyCheck = h.HostKeyCheck
+	}
+
+	return &r, nil
+}
+
+// Config returns the ssh config of the host and of its jump hosts in
+// the order they are connected. The host may be a named host in the
+// global config or an alias in ~/.ssh/config. Values set on the block
+// take precedence.
+func (s *Ssh) Config() (*ssh.Config, []*ssh.Config, error) {
+	r, err := s.Resolve()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := &Host{
+		Host:         r.Host,
+		Port:         r.Port,
+		User:         r.User,
+		Identity:     r.Identity,
+		HostKeyCheck: r.HostKeyCheck,
+		Passphrase:   r.Passphrase,
+	}
+
+	return h.Config()
+}
+
+func sshConfig(h *Host) (*ssh.Config, []*ssh.Config, error) {
+	mode, err := ssh.ParseHostKeyMode(h.HostKeyCheck)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hc, err := resolveSshHost(h.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if h.User != "" {
+		hc.User = h.User
+	}
+
+	if h.Port != 0 {
+		hc.Port = h.Port
+	}
+
+	keys := hc.Keys()
+	if h.Identity != "" {
+		keys = []string{ssh.ExpandHome(h.Identity)}
+	}
+
+	cfg, err := newSshConfig(hc, keys, mode, h.Passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jumps, err := jumpConfigs(hc.ProxyJump, mode, map[string]bool{hc.Alias: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, jumps, nil
+}
+
+// jumpConfigs returns the ssh configs of the ProxyJump hosts in the
+// order they are connected. Like ssh, the first jump host is connected
+// through its own ProxyJump, resolved recursively, while the later
+// hosts are connected through the hosts before them. seen holds the
+// hosts of the chain to detect cycles.
+func jumpConfigs(proxyJump []string, mode ssh.HostKeyMode, seen map[string]bool) ([]*ssh.Config, error) {
+	jumps := []*ssh.Config{}
+	for i, j := range proxyJump {
+		jh, err := ssh.ParseJumpHost(j)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[jh.Host] {
+			return nil, fmt.Errorf("ProxyJump loop at %s", jh.Host)
+		}
+
+		seen[jh.Host] = true
+		jhc, err := resolveSshHost(jh.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 && len(jhc.ProxyJump) > 0 {
+			inner, err := jumpConfigs(jhc.ProxyJump, mode, seen)
+			if err != nil {
+				return nil, err
+			}
+
+			jumps = append(jumps, inner...)
+		}
+
+		if jh.User != "" {
+			jhc.User = jh.User
+		}
+
+		if jh.Port != 0 {
+			jhc.Port = jh.Port
+		}
+
+		jc, err := newSshConfig(jhc, jhc.Keys(), mode, "")
+		if err != nil {
+			return nil, err
+		}
+
+		jumps = append(jumps, jc)
+	}
+
+	return jumps, nil
+}
+
+// resolveSshHost returns the host from ~/.ssh/config or the host
+// itself when it is not an alias.
+func resolveSshHost(host string) (*ssh.HostConfig, error) {
+	hc, err := ssh.FindConfig(host)
+	if errors.Is(err, ssh.ErrConfigNotFound) || errors.Is(err, ssh.ErrHostNotFound) {
+		return &ssh.HostConfig{Alias: host, HostName: host}, nil
+	}
+
+	return hc, err
+}
+
+func newSshConfig(hc *ssh.HostConfig, keys []string, mode ssh.HostKeyMode, passphrase string) (*ssh.Config, error) {
+	hostKey, err := hc.HostKeyCallback(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	algos, err := hc.HostKeyAlgorithms(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	user := hc.User
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+
+	return &ssh.Config{
+		User: user,
+		Host: hc.HostName,
+		Port: hc.Port,
+		Auth: &ssh.Auth{
+			Keys:               keys,
+			Agent:              true,
+			Passphrase:         []byte(passphrase),
+			PassphraseCallback: ssh.PromptPassphrase,
+		},
+		HostKey:           hostKey,
+		HostKeyAlgorithms: algos,
+		Timeout:           30 * time.Second,
+	}, nil
 }
 
 type Compose struct {
@@ -160,6 +396,23 @@ type Compose struct {
 	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
 	Context string   `json:"context,omitempty" yaml:"context,omitempty"`
 	Sudo    bool     `json:"sudo,omitempty" yaml:"sudo,omitempty"`
+
+	// Rollback redeploys the compose spec and image digests of the
+	// last successful deploy when a deploy fails.
+	Rollback bool `json:"rollback,omitempty" yaml:"rollback,omitempty"`
+
+	// swarm / stack mode options
+	WithRegistryAuth bool   `json:"with-registry-auth,omitempty" yaml:"with-registry-auth,omitempty"`
+	Prune            bool   `json:"prune,omitempty" yaml:"prune,omitempty"`
+	ResolveImage     string `json:"resolve-image,omitempty" yaml:"resolve-image,omitempty"`
+	NoWait           bool   `json:"no-wait,omitempty" yaml:"no-wait,omitempty"`
+	Timeout          string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// IsStack returns true when the compose block is deployed as a swarm
+// stack.
+func (c *Compose) IsStack() bool {
+	return c.Mode == "swarm" || c.Mode == "stack"
 }
 
 func (j *Jolt9) ResolveInheritence(dir string) (*Jolt9, error) {
@@ -326,15 +579,75 @@ func (j *Jolt9) MergeSecrets(secrets []Secret) {
 	}
 }
 
+// ApplyWorkspace merges the workspace vaults and secrets into the
+// j9d file with the values of the j9d file taking priority. When the
+// dns block uses a named workspace dns entry, the entry is used as the
+// base for the dns block.
+func (j *Jolt9) ApplyWorkspace(ws *Workspace) {
+	if ws == nil {
+		return
+	}
+
+	j.PrependMergeVaults(ws.Vaults)
+	j.PrependMergeSecrets(ws.Secrets)
+
+	if j.Dns == nil || j.Dns.Use == "" {
+		return
+	}
+
+	d, ok := ws.Dns[j.Dns.Use]
+	if !ok {
+		return
+	}
+
+	next := &Dns{
+		Driver: d.Driver,
+		Zone:   d.Zone,
+		Env:    map[string]string{},
+	}
+
+	for k, v := range d.Env {
+		next.Env[k] = v
+	}
+
+	for k, v := range j.Dns.Env {
+		next.Env[k] = v
+	}
+
+	if j.Dns.Zone != "" {
+		next.Zone = j.Dns.Zone
+	}
+
+	j.Dns = next
+}
+
 func (j *Jolt9) Merge(j2 *Jolt9) {
 	if j2 == nil {
 		return
 	}
 
+	if j2.Name != "" {
+		j.Name = j2.Name
+	}
+
 	if j2.Compose != nil {
 		j.Compose = j2.Compose
 	}
 
+	if j2.Ssh != nil {
+		j.Ssh = j2.Ssh
+	}
+
+	if len(j2.Env) > 0 {
+		if j.Env == nil {
+			j.Env = map[string]string{}
+		}
+
+		for k, v := range j2.Env {
+			j.Env[k] = v
+		}
+	}
+
 	if j2.Dns != nil {
 		j.Dns = j2.Dns
 	}
@@ -388,13 +701,45 @@ func (j *Jolt9) Merge(j2 *Jolt9) {
 	}
 
 	if j2.Hooks != nil {
-		if j2.Hooks.Before != nil && len(j2.Hooks.Before) > 0 {
+		if j.Hooks == nil {
+			j.Hooks = &Hooks{}
+		}
+
+		if len(j2.Hooks.Before) > 0 {
 			j.Hooks.Before = j2.Hooks.Before
 		}
 
-		if j2.Hooks.After != nil && len(j2.Hooks.After) > 0 {
+		if len(j2.Hooks.After) > 0 {
 			j.Hooks.After = j2.Hooks.After
 		}
+
+		if len(j2.Hooks.BeforeDeploy) > 0 {
+			j.Hooks.BeforeDeploy = j2.Hooks.BeforeDeploy
+		}
+
+		if len(j2.Hooks.AfterDeploy) > 0 {
+			j.Hooks.AfterDeploy = j2.Hooks.AfterDeploy
+		}
+
+		if len(j2.Hooks.BeforeRemove) > 0 {
+			j.Hooks.BeforeRemove = j2.Hooks.BeforeRemove
+		}
+
+		if len(j2.Hooks.AfterRemove) > 0 {
+			j.Hooks.AfterRemove = j2.Hooks.AfterRemove
+		}
+
+		if len(j2.Hooks.OnFailure) > 0 {
+			j.Hooks.OnFailure = j2.Hooks.OnFailure
+		}
+
+		if len(j2.Hooks.AfterFailure) > 0 {
+			j.Hooks.AfterFailure = j2.Hooks.AfterFailure
+		}
+
+		if len(j2.Hooks.Always) > 0 {
+			j.Hooks.Always = j2.Hooks.Always
+		}
 	}
 }
 
@@ -412,6 +757,14 @@ type Hooks struct {
 	AfterDeploy  []Task `json:"after-deploy" yaml:"after-deploy"`
 	BeforeRemove []Task `json:"before-remove" yaml:"before-remove"`
 	AfterRemove  []Task `json:"after-remove" yaml:"after-remove"`
+
+	// OnFailure runs when the action or one of its hooks fails and
+	// AfterFailure runs after the rollback of a failed deploy.
+	OnFailure    []Task `json:"on-failure,omitempty" yaml:"on-failure,omitempty"`
+	AfterFailure []Task `json:"after-failure,omitempty" yaml:"after-failure,omitempty"`
+
+	// Always runs last whether the action failed or not.
+	Always []Task `json:"always,omitempty" yaml:"always,omitempty"`
 }
 
 type Task struct {
@@ -420,8 +773,42 @@ type Task struct {
 	Timeout string            `json:"timeout" yaml:"timeout"`
 	Env     map[string]string `json:"env" yaml:"env"`
 	Use     string            `json:"use" yaml:"use"`
+
+	// With are the inputs of the task runner of use e.g. url and
+	// status for use: http.
+	With map[string]string `json:"with,omitempty" yaml:"with,omitempty"`
+
+	// On is local or remote. Remote tasks run on the host of the ssh
+	// block. Defaults to local.
+	On string `json:"on,omitempty" yaml:"on,omitempty"`
+
+	// Host runs the task on a named host e.g. @db-1 or an ssh alias.
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+
+	// Cwd is the working directory of the task. Relative paths are
+	// relative to the j9d file or the ssh dir of remote tasks.
+	Cwd string `json:"cwd,omitempty" yaml:"cwd,omitempty"`
+
+	// If skips the task unless the condition is true e.g.
+	// $ENV == prod && $MIGRATE.
+	If string `json:"if,omitempty" yaml:"if,omitempty"`
+
+	// Retries is the number of times a failed task is run again.
+	// RetryDelay is the delay before the first retry and doubles
+	// after each retry. Defaults to 1s.
+	Retries    int    `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryDelay string `json:"retry-delay,omitempty" yaml:"retry-delay,omitempty"`
+
+	// ContinueOnError logs the error of a failed task instead of
+	// stopping the deployment.
+	ContinueOnError bool `json:"continue-on-error,omitempty" yaml:"continue-on-error,omitempty"`
 }
 
+const (
+	TaskOnLocal  = "local"
+	TaskOnRemote = "remote"
+)
+
 type Workspace struct {
 	Name      string             `json:"name" yaml:"name"`
 	Vaults    []Vault            `json:"vaults,omitempty" yaml:"vaults,omitempty"`
@@ -457,6 +844,16 @@ func (p *Project) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+func (p Project) MarshalYAML() (interface{}, error) {
+	if len(p.Targets) == 1 {
+		if v, ok := p.Targets["default"]; ok {
+			return v, nil
+		}
+	}
+
+	return p.Targets, nil
+}
+
 type Discovery struct {
 	Include []string `json:"include" yaml:"include"`
 	Exclude []string `json:"exclude" yaml:"exclude"`
@@ -484,13 +881,25 @@ func (cfg *WorkspaceFile) Save() error {
 		return err
 	}
 
+	err = fs.EnsureDir(filepath.Dir(cfg.File), 0755)
+	if err != nil {
+		return err
+	}
+
 	return fs.WriteFile(cfg.File, data, 0644)
 }
 
 type GlobalConfig struct {
 	Hosts      map[string]Host   `json:"hosts" yaml:"hosts"`
 	Workspaces map[string]string `json:"scopes" yaml:"scopes"`
-	Paths      *GlobalPaths      `json:"paths" yaml:"paths"`
+	Paths      *GlobalPaths      `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
+// Host returns the host registered under the name. The name may start
+// with @.
+func (cfg *GlobalConfig) Host(name string) (Host, bool) {
+	h, ok := cfg.Hosts[strings.TrimPrefix(name, "@")]
+	return h, ok
 }
 
 type GlobalPaths struct {
@@ -512,14 +921,14 @@ func (cfg *GlobalConfigFile) Load() error {
 		cfg.Config = &GlobalConfig{}
 	}
 
-	if !fs.Exists(cfgDir) {
-		return nil
-	}
+	if fs.Exists(cfgDir) {
+		try := []string{"config.yaml", "config.yml", "config.json"}
+		for _, t := range try {
+			file := filepath.Join(cfgDir, t)
+			if !fs.Exists(file) {
+				continue
+			}
 
-	try := []string{"config.yaml", "config.yml", "config.json"}
-	for _, t := range try {
-		file := filepath.Join(cfgDir, t)
-		if fs.Exists(file) {
 			cfg.File = file
 			data, err := fs.ReadFile(file)
 			if err != nil {
@@ -538,61 +947,97 @@ func (cfg *GlobalConfigFile) Load() error {
 				return err
 			}
 
-			return nil
+			break
 		}
 	}
 
 	if cfg.Config.Paths == nil {
 		cfg.Config.Paths = &GlobalPaths{}
-		if cfg.Config.Paths.Cache == "" {
-			cacheDir, err := paths.CacheDir()
-			if err != nil {
-				return err
-			}
+	}
 
-			cfg.Config.Paths.Cache = cacheDir
+	if cfg.Config.Paths.Cache == "" {
+		cacheDir, err := paths.CacheDir()
+		if err != nil {
+			return err
 		}
+
+		cfg.Config.Paths.Cache = cacheDir
 	}
 
 	if cfg.Config.Workspaces == nil {
 		cfg.Config.Workspaces = make(map[string]string)
 	}
 
-	_, ok := cfg.Config.Workspaces["@default"]
+	_, ok := cfg.Config.Workspaces["default"]
 	if !ok {
-		dir, err := paths.ConfigDir()
-		if err != nil {
-			return err
-		}
+		_, ok = cfg.Config.Workspaces["@default"]
+	}
+
+	// the global default workspace is only written by the workspace
+	// commands that change it.
+	if !ok {
+		cfg.Config.Workspaces["default"] = filepath.Join(cfgDir, consts.WorkspaceFileName)
+	}
+
+	return nil
+}
 
-		// global default workspace.
-		wsf := filepath.Join(dir, consts.WorkspaceFileName)
+// DefaultWorkspaceFile returns the file of the global default workspace.
+func DefaultWorkspaceFile() (string, error) {
+	cfgDir, err := paths.ConfigDir()
+	if err != nil {
+		return "", err
+	}
 
-		cfg.Config.Workspaces["default"] = wsf
+	return filepath.Join(cfgDir, consts.WorkspaceFileName), nil
+}
 
-		ws := Workspace{
+// NewDefaultWorkspaceFile returns the empty global default workspace,
+// used until it is saved for the first time.
+func NewDefaultWorkspaceFile(file string) *WorkspaceFile {
+	return &WorkspaceFile{
+		File: file,
+		Config: &Workspace{
 			Name: "default",
-		}
+			Discovery: &Discovery{
+				Include: []string{},
+				Exclude: []string{},
+			},
+			Projects: make(map[string]Project),
+		},
+	}
+}
 
-		ws.Discovery = &Discovery{
-			Include: []string{},
-			Exclude: []string{},
+// saved returns a copy of the config without the defaults set by Load,
+// so that they are not written to the file.
+func (cfg *GlobalConfigFile) saved() (*GlobalConfig, error) {
+	out := *cfg.Config
+	if out.Paths != nil {
+		cacheDir, err := paths.CacheDir()
+		if err != nil {
+			return nil, err
 		}
 
-		ws.Projects = make(map[string]Project)
-
-		wsFile := &WorkspaceFile{
-			File:   wsf,
-			Config: &ws,
+		if out.Paths.Cache == cacheDir {
+			out.Paths = nil
 		}
+	}
 
-		err = wsFile.Save()
-		if err != nil {
-			return err
+	wsf, err := DefaultWorkspaceFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if out.Workspaces["default"] == wsf {
+		out.Workspaces = make(map[string]string)
+		for k, v := range cfg.Config.Workspaces {
+			if k != "default" {
+				out.Workspaces[k] = v
+			}
 		}
 	}
 
-	return nil
+	return &out, nil
 }
 
 func (cfg *GlobalConfigFile) Save() error {
@@ -602,7 +1047,9 @@ func (cfg *GlobalConfigFile) Save() error {
 			return err
 		}
 
-		cfg.Config = &GlobalConfig{}
+		if cfg.Config == nil {
+			cfg.Config = &GlobalConfig{}
+		}
 
 		err = fs.EnsureDir(cfgDir, 0755)
 		if err != nil {
@@ -612,22 +1059,35 @@ func (cfg *GlobalConfigFile) Save() error {
 		cfg.File = filepath.Join(cfgDir, "config.yaml")
 	}
 
+	out, err := cfg.saved()
+	if err != nil {
+		return err
+	}
+
+	// the hosts of the global config may hold credentials. WriteFile
+	// only applies the mode when it creates the file, so existing files
+	// keep their mode unless they are changed first.
+	err = os.Chmod(cfg.File, 0600)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
 	ext := filepath.Ext(cfg.File)
 	switch ext {
 	case ".json":
-		data, err := json.MarshalIndent(cfg.Config, "", "    ")
+		data, err := json.MarshalIndent(out, "", "    ")
 		if err != nil {
 			return err
 		}
 
-		return fs.WriteFile(cfg.File, data, 0644)
+		return fs.WriteFile(cfg.File, data, 0600)
 	case ".yaml", ".yml":
-		data, err := yaml.Marshal(cfg.Config)
+		data, err := yaml.Marshal(out)
 		if err != nil {
 			return err
 		}
 
-		return fs.WriteFile(cfg.File, data, 0644)
+		return fs.WriteFile(cfg.File, data, 0600)
 	}
 
 	return errors.New("unsupported file extension")
@@ -638,4 +1098,20 @@ type Host struct {
 	Port     int    `json:"port" yaml:"port"`
 	User     string `json:"user" yaml:"user"`
 	Identity string `json:"identity" yaml:"identity"`
+
+	// HostKeyCheck is strict, accept-new or off. The global
+	// --host-key-check flag is used when empty.
+	HostKeyCheck string `json:"host-key-check,omitempty" yaml:"host-key-check,omitempty"`
+
+	// Passphrase decrypts an encrypted identity. It is never written
+	// to the global config, it is set from the passphrase of the ssh
+	// block e.g. a secret from a vault or prompted for.
+	Passphrase string `json:"-" yaml:"-"`
+}
+
+// Config returns the ssh config of the host and of its jump hosts in
+// the order they are connected. The host may be an alias in
+// ~/.ssh/config.
+func (h *Host) Config() (*ssh.Config, []*ssh.Config, error) {
+	return sshConfig(h)
 }
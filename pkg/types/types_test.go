@@ -0,0 +1,126 @@
+package types_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyWorkspace(t *testing.T) {
+	ws := &types.Workspace{
+		Name: "org",
+		Vaults: []types.Vault{
+			{Name: "shared", Uri: "sops://./shared.env"},
+			{Name: "local", Uri: "sops://./ws.env"},
+		},
+		Secrets: []types.Secret{
+			{Name: "REGISTRY_PASSWORD"},
+			{Name: "TOKEN", Vault: "shared"},
+		},
+		Dns: map[string]types.Dns{
+			"cloudflare": {
+				Driver: "cloudflare",
+				Zone:   "example.com",
+				Env:    map[string]string{"CF_API_EMAIL": "ops@example.com"},
+			},
+		},
+	}
+
+	j := &types.Jolt9{
+		Name: "traefik",
+		Vaults: []types.Vault{
+			{Name: "local", Uri: "sops://./project.env"},
+		},
+		Secrets: []types.Secret{
+			{Name: "TOKEN", Vault: "local"},
+		},
+		Dns: &types.Dns{
+			Use:  "cloudflare",
+			Zone: "traefik.example.com",
+		},
+	}
+
+	j.ApplyWorkspace(ws)
+
+	assert.Len(t, j.Vaults, 2)
+	assert.Equal(t, "shared", j.Vaults[0].Name)
+	assert.Equal(t, "sops://./project.env", j.Vaults[1].Uri)
+
+	assert.Len(t, j.Secrets, 2)
+	assert.Equal(t, "REGISTRY_PASSWORD", j.Secrets[0].Name)
+	assert.Equal(t, "local", j.Secrets[1].Vault)
+
+	assert.Equal(t, "cloudflare", j.Dns.Driver)
+	assert.Equal(t, "traefik.example.com", j.Dns.Zone)
+	assert.Equal(t, "ops@example.com", j.Dns.Env["CF_API_EMAIL"])
+	assert.Empty(t, j.Dns.Use)
+}
+
+func TestSshConfigAlias(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(`
+Host prod-db
+    HostName 10.0.0.5
+    User deploy
+    ProxyJump bastion
+Host bastion
+    HostName bastion.example.com
+    User jump
+    Port 2200
+`), 0600))
+
+	s := &types.Ssh{Host: "prod-db", Port: 2022}
+	cfg, jumps, err := s.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", cfg.Host)
+	assert.Equal(t, "deploy", cfg.User)
+	assert.Equal(t, 2022, cfg.Port)
+	assert.Len(t, jumps, 1)
+	assert.Equal(t, "bastion.example.com", jumps[0].Host)
+	assert.Equal(t, "jump", jumps[0].User)
+	assert.Equal(t, 2200, jumps[0].Port)
+
+	h := &types.Host{Host: "10.0.0.9", User: "root"}
+	cfg, jumps, err = h.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.9", cfg.Host)
+	assert.Equal(t, "root", cfg.User)
+	assert.Empty(t, jumps)
+}
+
+func TestSshConfigProxyJumpChain(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(`
+Host prod-db
+    HostName 10.0.0.5
+    ProxyJump bastion
+Host bastion
+    HostName bastion.example.com
+    ProxyJump edge
+Host edge
+    HostName edge.example.com
+Host loop-a
+    ProxyJump loop-b
+Host loop-b
+    ProxyJump loop-a
+`), 0600))
+
+	s := &types.Ssh{Host: "prod-db", User: "deploy"}
+	cfg, jumps, err := s.Config()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", cfg.Host)
+	assert.Len(t, jumps, 2)
+	assert.Equal(t, "edge.example.com", jumps[0].Host)
+	assert.Equal(t, "bastion.example.com", jumps[1].Host)
+
+	s = &types.Ssh{Host: "loop-a", User: "deploy"}
+	_, _, err = s.Config()
+	assert.ErrorContains(t, err, "ProxyJump loop")
+}
@@ -0,0 +1,570 @@
+package hcvault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jolt9dev/j9d/pkg/vaults"
+)
+
+// ErrNotFound is returned when a secret or a key of a secret does not
+// exist.
+var ErrNotFound = errors.New("secret not found")
+
+// HcVaultSecretVault reads and writes the secrets of a HashiCorp Vault
+// kv v2 engine. Keys are fields of the secret at the path of the vault,
+// keys with slashes e.g. db/password are the password field of the db
+// secret under the path.
+type HcVaultSecretVault struct {
+	params HcVaultSecretVaultParams
+	client *http.Client
+	token  string
+	cache  map[string]*kvSecret
+}
+
+type HcVaultAuthParams struct {
+	// Method is token, approle or jwt. Defaults to token.
+	Method string
+	// Mount is the mount of the auth method. Defaults to the method.
+	Mount    string
+	Token    string
+	RoleId   string
+	SecretId string
+	Role     string
+	Jwt      string
+}
+
+type HcVaultSecretVaultParams struct {
+	// Address of the vault server e.g. https://vault.example.com:8200.
+	Address   string
+	Namespace string
+	// Mount is the mount of the kv v2 engine e.g. secret.
+	Mount string
+	// Path is the path of the secret in the engine e.g. apps/web.
+	Path    string
+	Auth    *HcVaultAuthParams
+	Timeout time.Duration
+}
+
+// kvSecret is a version of a secret. The raw values are written back
+// as is so that values that are not strings keep their type.
+type kvSecret struct {
+	data    map[string]string
+	raw     map[string]json.RawMessage
+	keys    []string
+	version int
+}
+
+func New(params HcVaultSecretVaultParams) *HcVaultSecretVault {
+	if params.Mount == "" {
+		params.Mount = "secret"
+	}
+
+	if params.Auth == nil {
+		params.Auth = &HcVaultAuthParams{}
+	}
+
+	if params.Auth.Method == "" {
+		params.Auth.Method = "token"
+	}
+
+	if params.Timeout == 0 {
+		params.Timeout = 30 * time.Second
+	}
+
+	params.Address = strings.TrimSuffix(params.Address, "/")
+	params.Mount = strings.Trim(params.Mount, "/")
+	params.Path = strings.Trim(params.Path, "/")
+
+	return &HcVaultSecretVault{
+		params: params,
+		client: &http.Client{Timeout: params.Timeout},
+		cache:  map[string]*kvSecret{},
+	}
+}
+
+var _ vaults.SecretVault = (*HcVaultSecretVault)(nil)
+
+// GetSecretValue returns the value of the key. The version of the
+// params reads an older version of the secret.
+func (v *HcVaultSecretVault) GetSecretValue(key string, params *vaults.GetSecretValueParams) (string, error) {
+	version := ""
+	if params != nil {
+		version = params.Version
+	}
+
+	path, field := v.split(key)
+	secret, err := v.read(path, version)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := secret.data[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return value, nil
+}
+
+func (v *HcVaultSecretVault) BatchGetSecretValues(keys []string, params *vaults.GetSecretValueParams) (map[string]string, error) {
+	values := map[string]string{}
+	for _, key := range keys {
+		value, err := v.GetSecretValue(key, params)
+		if err != nil {
+			return nil, err
+		}
+
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+func (v *HcVaultSecretVault) MapSecretValues(query map[string]string, params *vaults.GetSecretValueParams) (map[string]string, error) {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+
+	res, err := v.BatchGetSecretValues(keys, params)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for k, name := range query {
+		if val, ok := res[k]; ok {
+			values[name] = val
+		}
+	}
+
+	return values, nil
+}
+
+// ListSecretNames returns the keys of the secret at the path and of the
+// secrets under the path.
+func (v *HcVaultSecretVault) ListSecretNames(params *vaults.ListSecretNamesParams) ([]string, error) {
+	names := []string{}
+	if v.params.Path != "" {
+		secret, err := v.read(v.params.Path, "")
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+
+		if err == nil {
+			names = append(names, secret.keys...)
+		}
+	}
+
+	err := v.list("", func(rel string) error {
+		secret, err := v.read(v.join(rel), "")
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		for _, k := range secret.keys {
+			names = append(names, rel+"/"+k)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func (v *HcVaultSecretVault) SetSecretValue(key, value string, params *vaults.SetSecretValueParams) error {
+	return v.BatchSetSecretValues(map[string]string{key: value}, nil)
+}
+
+// BatchSetSecretValues writes a new version of each secret with the
+// values merged into its current data.
+func (v *HcVaultSecretVault) BatchSetSecretValues(values map[string]string, params *vaults.SetSecretValueParams) error {
+	updates := map[string]map[string]string{}
+	for key, value := range values {
+		path, field := v.split(key)
+		if updates[path] == nil {
+			updates[path] = map[string]string{}
+		}
+
+		updates[path][field] = value
+	}
+
+	paths := make([]string, 0, len(updates))
+	for p := range updates {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		secret, err := v.read(path, "")
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		if secret == nil {
+			secret = &kvSecret{}
+		}
+
+		data := map[string]interface{}{}
+		for k, value := range secret.raw {
+			data[k] = value
+		}
+
+		for k, value := range updates[path] {
+			data[k] = value
+		}
+
+		err = v.write(path, data, secret.version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteSecret removes the key from the secret. The latest version of
+// the secret is deleted when it has no keys left.
+func (v *HcVaultSecretVault) DeleteSecret(key string, params *vaults.DeleteSecretParams) error {
+	path, field := v.split(key)
+	secret, err := v.read(path, "")
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	if _, ok := secret.data[field]; !ok {
+		return nil
+	}
+
+	data := map[string]interface{}{}
+	for k, value := range secret.raw {
+		if k != field {
+			data[k] = value
+		}
+	}
+
+	if len(data) > 0 {
+		return v.write(path, data, secret.version)
+	}
+
+	delete(v.cache, path)
+	_, err = v.do(http.MethodDelete, v.params.Mount+"/data/"+path, nil, nil)
+	return err
+}
+
+// split returns the path of the secret and the field of the key.
+func (v *HcVaultSecretVault) split(key string) (string, string) {
+	key = strings.Trim(key, "/")
+	i := strings.LastIndex(key, "/")
+	if i < 0 {
+		return v.params.Path, key
+	}
+
+	return v.join(key[:i]), key[i+1:]
+}
+
+func (v *HcVaultSecretVault) join(rel string) string {
+	if v.params.Path == "" {
+		return rel
+	}
+
+	return v.params.Path + "/" + rel
+}
+
+// read returns the data of the secret. The latest version is cached
+// until the secret is written.
+func (v *HcVaultSecretVault) read(path, version string) (*kvSecret, error) {
+	if version == "" {
+		if secret, ok := v.cache[path]; ok {
+			return secret, nil
+		}
+	}
+
+	query := url.Values{}
+	if version != "" {
+		query.Set("version", version)
+	}
+
+	res := struct {
+		Data struct {
+			Data     map[string]json.RawMessage `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}{}
+
+	status, err := v.do(http.MethodGet, v.params.Mount+"/data/"+path+encodeQuery(query), nil, &res)
+	if status == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// deleted versions are returned without data.
+	if res.Data.Data == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+
+	secret := &kvSecret{data: map[string]string{}, raw: res.Data.Data, version: res.Data.Metadata.Version}
+	for k, raw := range res.Data.Data {
+		secret.data[k] = rawString(raw)
+		secret.keys = append(secret.keys, k)
+	}
+
+	sort.Strings(secret.keys)
+	if version == "" {
+		v.cache[path] = secret
+	}
+
+	return secret, nil
+}
+
+// write writes a new version of the secret. The check-and-set version
+// of an existing secret fails the write when it changed since it was
+// read.
+func (v *HcVaultSecretVault) write(path string, data map[string]interface{}, cas int) error {
+	body := map[string]interface{}{"data": data}
+	if cas > 0 {
+		body["options"] = map[string]interface{}{"cas": cas}
+	}
+
+	delete(v.cache, path)
+	_, err := v.do(http.MethodPost, v.params.Mount+"/data/"+path, body, nil)
+	return err
+}
+
+// list calls fn with the path of each secret under the path of the
+// vault relative to it.
+func (v *HcVaultSecretVault) list(rel string, fn func(rel string) error) error {
+	path := v.params.Path
+	if rel != "" {
+		path = v.join(rel)
+	}
+
+	res := struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}{}
+
+	status, err := v.do("LIST", v.params.Mount+"/metadata/"+path, nil, &res)
+	if status == http.StatusNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, k := range res.Data.Keys {
+		next := strings.TrimSuffix(k, "/")
+		if rel != "" {
+			next = rel + "/" + next
+		}
+
+		if strings.HasSuffix(k, "/") {
+			err = v.list(next, fn)
+		} else {
+			err = fn(next)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// login returns the token of the vault and logs in with approle or jwt
+// on first use.
+func (v *HcVaultSecretVault) login() (string, error) {
+	if v.token != "" {
+		return v.token, nil
+	}
+
+	auth := v.params.Auth
+	body := map[string]string{}
+	switch auth.Method {
+	case "token":
+		v.token = auth.Token
+		if v.token == "" {
+			v.token = os.Getenv("VAULT_TOKEN")
+		}
+
+		if v.token == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+					v.token = strings.TrimSpace(string(data))
+				}
+			}
+		}
+
+		if v.token == "" {
+			return "", fmt.Errorf("no vault token found")
+		}
+
+		return v.token, nil
+
+	case "approle":
+		if auth.RoleId == "" || auth.SecretId == "" {
+			return "", fmt.Errorf("approle auth requires role-id and secret-id")
+		}
+
+		body["role_id"] = auth.RoleId
+		body["secret_id"] = auth.SecretId
+
+	case "jwt", "oidc":
+		if auth.Jwt == "" {
+			return "", fmt.Errorf("jwt auth requires a jwt")
+		}
+
+		body["role"] = auth.Role
+		body["jwt"] = auth.Jwt
+
+	default:
+		return "", fmt.Errorf("unsupported vault auth method %s", auth.Method)
+	}
+
+	mount := auth.Mount
+	if mount == "" {
+		mount = auth.Method
+	}
+
+	res := struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}{}
+
+	_, err := v.send(http.MethodPost, "auth/"+strings.Trim(mount, "/")+"/login", "", body, &res)
+	if err != nil {
+		return "", fmt.Errorf("vault %s login failed: %w", auth.Method, err)
+	}
+
+	if res.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault %s login returned no token", auth.Method)
+	}
+
+	v.token = res.Auth.ClientToken
+	return v.token, nil
+}
+
+func (v *HcVaultSecretVault) do(method, path string, body, out interface{}) (int, error) {
+	token, err := v.login()
+	if err != nil {
+		return 0, err
+	}
+
+	return v.send(method, path, token, body, out)
+}
+
+// send calls the vault api and decodes the json response into out.
+func (v *HcVaultSecretVault) send(method, path, token string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, v.params.Address+"/v1/"+path, reader)
+	if err != nil {
+		return 0, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	if v.params.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.params.Namespace)
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, err
+	}
+
+	if res.StatusCode >= 300 {
+		errs := struct {
+			Errors []string `json:"errors"`
+		}{}
+
+		if json.Unmarshal(data, &errs) == nil && len(errs.Errors) > 0 {
+			return res.StatusCode, fmt.Errorf("vault %s %s returned %d: %s", method, path, res.StatusCode, strings.Join(errs.Errors, ", "))
+		}
+
+		return res.StatusCode, fmt.Errorf("vault %s %s returned %d", method, path, res.StatusCode)
+	}
+
+	if out != nil && len(data) > 0 {
+		err = json.Unmarshal(data, out)
+		if err != nil {
+			return res.StatusCode, fmt.Errorf("invalid vault response: %w", err)
+		}
+	}
+
+	return res.StatusCode, nil
+}
+
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+
+	return "?" + query.Encode()
+}
+
+// rawString returns json strings as is and other values as json.
+func rawString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	if string(raw) == "null" {
+		return ""
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,261 @@
+package hcvault_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/vaults"
+	"github.com/jolt9dev/j9d/pkg/vaults/hcvault"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVault imitates the kv v2 engine mounted at secret and the approle
+// and jwt auth methods of a vault server.
+type fakeVault struct {
+	mu       sync.Mutex
+	token    string
+	versions map[string][]map[string]interface{}
+	deleted  map[string]bool
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	f := &fakeVault{
+		token:    "root",
+		versions: map[string][]map[string]interface{}{},
+		deleted:  map[string]bool{},
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "auth/approle/login" || path == "auth/jwt/login":
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["secret_id"] != "s3cr3t" && body["jwt"] != "ey.jwt" {
+			reply(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"invalid credentials"}})
+			return
+		}
+
+		reply(w, http.StatusOK, map[string]interface{}{"auth": map[string]string{"client_token": f.token}})
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != f.token {
+		reply(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "secret/data/"):
+		f.data(w, r, strings.TrimPrefix(path, "secret/data/"))
+	case strings.HasPrefix(path, "secret/metadata/") && r.Method == "LIST":
+		f.list(w, strings.TrimPrefix(path, "secret/metadata/"))
+	default:
+		reply(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+	}
+}
+
+func (f *fakeVault) data(w http.ResponseWriter, r *http.Request, path string) {
+	versions := f.versions[path]
+	switch r.Method {
+	case http.MethodGet:
+		n := len(versions)
+		if v := r.URL.Query().Get("version"); v != "" {
+			n, _ = strconv.Atoi(v)
+		}
+
+		if n < 1 || n > len(versions) || (n == len(versions) && f.deleted[path]) {
+			reply(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+
+		reply(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     versions[n-1],
+				"metadata": map[string]int{"version": n},
+			},
+		})
+
+	case http.MethodPost, http.MethodPut:
+		body := struct {
+			Options map[string]int         `json:"options"`
+			Data    map[string]interface{} `json:"data"`
+		}{}
+
+		json.NewDecoder(r.Body).Decode(&body)
+		if cas, ok := body.Options["cas"]; ok && cas != len(versions) {
+			reply(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+
+		f.versions[path] = append(versions, body.Data)
+		f.deleted[path] = false
+		reply(w, http.StatusOK, map[string]interface{}{"data": map[string]int{"version": len(versions) + 1}})
+
+	case http.MethodDelete:
+		f.deleted[path] = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeVault) list(w http.ResponseWriter, path string) {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	seen := map[string]bool{}
+	keys := []string{}
+	for p := range f.versions {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+
+		k := strings.TrimPrefix(p, prefix)
+		if i := strings.Index(k, "/"); i >= 0 {
+			k = k[:i+1]
+		}
+
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) == 0 {
+		reply(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+		return
+	}
+
+	sort.Strings(keys)
+	reply(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestHcVaultSecretVault(t *testing.T) {
+	f, srv := newFakeVault(t)
+	f.versions["apps/web"] = []map[string]interface{}{
+		{"password": "old", "port": 5432},
+	}
+
+	vault := hcvault.New(hcvault.HcVaultSecretVaultParams{
+		Address: srv.URL,
+		Path:    "apps/web",
+		Auth:    &hcvault.HcVaultAuthParams{Token: "root"},
+	})
+
+	v, err := vault.GetSecretValue("password", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", v)
+
+	v, err = vault.GetSecretValue("port", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "5432", v)
+
+	_, err = vault.GetSecretValue("missing", nil)
+	assert.ErrorIs(t, err, hcvault.ErrNotFound)
+
+	assert.NoError(t, vault.SetSecretValue("password", "new", nil))
+	assert.NoError(t, vault.BatchSetSecretValues(map[string]string{
+		"db/user":     "app",
+		"db/password": "pw",
+	}, nil))
+
+	v, err = vault.GetSecretValue("password", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", v)
+
+	v, err = vault.GetSecretValue("password", &vaults.GetSecretValueParams{Version: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "old", v)
+
+	v, err = vault.GetSecretValue("db/user", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", v)
+	assert.Len(t, f.versions["apps/web"], 2)
+	assert.Equal(t, 5432.0, f.versions["apps/web"][1]["port"])
+
+	names, err := vault.ListSecretNames(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"password", "port", "db/password", "db/user"}, names)
+
+	values, err := vault.MapSecretValues(map[string]string{"db/user": "DB_USER"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"DB_USER": "app"}, values)
+
+	assert.NoError(t, vault.DeleteSecret("db/user", nil))
+	assert.NoError(t, vault.DeleteSecret("db/password", nil))
+	assert.True(t, f.deleted["apps/web/db"])
+
+	_, err = vault.GetSecretValue("db/password", nil)
+	assert.ErrorIs(t, err, hcvault.ErrNotFound)
+}
+
+func TestHcVaultCheckAndSet(t *testing.T) {
+	f, srv := newFakeVault(t)
+	f.versions["app"] = []map[string]interface{}{{"token": "a"}}
+
+	vault := hcvault.New(hcvault.HcVaultSecretVaultParams{
+		Address: srv.URL,
+		Path:    "app",
+		Auth:    &hcvault.HcVaultAuthParams{Token: "root"},
+	})
+
+	_, err := vault.GetSecretValue("token", nil)
+	assert.NoError(t, err)
+
+	// another client writes a new version after the read.
+	f.versions["app"] = append(f.versions["app"], map[string]interface{}{"token": "b"})
+
+	err = vault.SetSecretValue("other", "c", nil)
+	assert.ErrorContains(t, err, "check-and-set")
+	assert.Len(t, f.versions["app"], 2)
+}
+
+func TestHcVaultAuth(t *testing.T) {
+	f, srv := newFakeVault(t)
+	f.versions["app"] = []map[string]interface{}{{"token": "a"}}
+
+	for _, auth := range []*hcvault.HcVaultAuthParams{
+		{Method: "approle", RoleId: "web", SecretId: "s3cr3t"},
+		{Method: "jwt", Role: "web", Jwt: "ey.jwt"},
+	} {
+		vault := hcvault.New(hcvault.HcVaultSecretVaultParams{Address: srv.URL, Path: "app", Auth: auth})
+		v, err := vault.GetSecretValue("token", nil)
+		assert.NoError(t, err, auth.Method)
+		assert.Equal(t, "a", v)
+	}
+
+	vault := hcvault.New(hcvault.HcVaultSecretVaultParams{
+		Address: srv.URL,
+		Path:    "app",
+		Auth:    &hcvault.HcVaultAuthParams{Method: "approle", RoleId: "web", SecretId: "wrong"},
+	})
+
+	_, err := vault.GetSecretValue("token", nil)
+	assert.ErrorContains(t, err, "invalid credentials")
+
+	vault = hcvault.New(hcvault.HcVaultSecretVaultParams{
+		Address: srv.URL,
+		Path:    "app",
+		Auth:    &hcvault.HcVaultAuthParams{Token: "wrong"},
+	})
+
+	_, err = vault.GetSecretValue("token", nil)
+	assert.ErrorContains(t, err, "permission denied")
+}
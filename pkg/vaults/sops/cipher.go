@@ -0,0 +1,143 @@
+package sops
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sops encrypts values with AES-256-GCM using a 32 byte nonce and the
+// path of the value as additional data.
+const (
+	nonceSize = 32
+	tagSize   = 16
+)
+
+var encPattern = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.*),tag:(.*),type:(.*)\]$`)
+
+// isEncrypted returns true when the value is an encrypted sops value.
+func isEncrypted(value string) bool {
+	return encPattern.MatchString(value)
+}
+
+// encryptValue encrypts the plaintext of a value of type str, int,
+// float or bool.
+func encryptValue(plaintext []byte, valueType string, key []byte, aad string) (string, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, nonceSize)
+	_, err = rand.Read(iv)
+	if err != nil {
+		return "", err
+	}
+
+	out := gcm.Seal(nil, iv, plaintext, []byte(aad))
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(out[:len(out)-tagSize]),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(out[len(out)-tagSize:]),
+		valueType), nil
+}
+
+// decryptValue returns the plaintext and type of an encrypted value.
+func decryptValue(value string, key []byte, aad string) ([]byte, string, error) {
+	m := encPattern.FindStringSubmatch(value)
+	if m == nil {
+		return nil, "", fmt.Errorf("value is not an encrypted sops value")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(m[1])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid encrypted data: %w", err)
+	}
+
+	iv, err := base64.StdEncoding.DecodeString(m[2])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid iv: %w", err)
+	}
+
+	tag, err := base64.StdEncoding.DecodeString(m[3])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid tag: %w", err)
+	}
+
+	gcm, err := newGcmWithNonceSize(key, len(iv))
+	if err != nil {
+		return nil, "", err
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(aad))
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to decrypt value at %s: %w", strings.TrimSuffix(aad, ":"), err)
+	}
+
+	return plaintext, m[4], nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	return newGcmWithNonceSize(key, nonceSize)
+}
+
+func newGcmWithNonceSize(key []byte, size int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCMWithNonceSize(block, size)
+}
+
+// plainValue returns the plaintext of a yaml scalar the way sops
+// encodes it e.g. booleans as True and False.
+func plainValue(tag, value string) ([]byte, string) {
+	switch tag {
+	case "!!int":
+		if i, err := strconv.ParseInt(value, 0, 64); err == nil {
+			return []byte(strconv.FormatInt(i, 10)), "int"
+		}
+	case "!!float":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return []byte(strconv.FormatFloat(f, 'f', -1, 64)), "float"
+		}
+	case "!!bool":
+		if b, err := strconv.ParseBool(strings.ToLower(value)); err == nil {
+			if b {
+				return []byte("True"), "bool"
+			}
+
+			return []byte("False"), "bool"
+		}
+	}
+
+	return []byte(value), "str"
+}
+
+// scalarValue returns the yaml tag and value of decrypted plaintext.
+func scalarValue(plaintext []byte, valueType string) (string, string, error) {
+	value := string(plaintext)
+	switch valueType {
+	case "str", "bytes", "comment":
+		return "!!str", value, nil
+	case "int":
+		return "!!int", value, nil
+	case "float":
+		return "!!float", value, nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", "", err
+		}
+
+		return "!!bool", strconv.FormatBool(b), nil
+	}
+
+	return "", "", fmt.Errorf("unknown sops value type %s", valueType)
+}
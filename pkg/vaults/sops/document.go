@@ -0,0 +1,207 @@
+package sops
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	FileTypeDotenv = "dotenv"
+	FileTypeYaml   = "yaml"
+	FileTypeJson   = "json"
+	FileTypeIni    = "ini"
+)
+
+// document is the decrypted content of a sops file. Keys of nested
+// documents are paths separated by dots e.g. db.password.
+type document interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) bool
+	Keys() []string
+	Marshal(indent int) ([]byte, error)
+}
+
+// DetectFileType returns the sops file type of the file extension.
+// Files without a known extension e.g. .env are dotenv files.
+func DetectFileType(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return FileTypeYaml
+	case ".json":
+		return FileTypeJson
+	case ".ini":
+		return FileTypeIni
+	}
+
+	return FileTypeDotenv
+}
+
+func newDocument(fileType string) (document, error) {
+	switch fileType {
+	case FileTypeDotenv:
+		return &dotenvDocument{data: map[string]string{}}, nil
+	case FileTypeYaml, FileTypeJson:
+		return newTreeDocument(fileType == FileTypeJson), nil
+	case FileTypeIni:
+		return &iniDocument{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported file type: %s", fileType)
+}
+
+func parseDocument(fileType string, data []byte) (document, error) {
+	switch fileType {
+	case FileTypeDotenv:
+		return parseDotenvDocument(data)
+	case FileTypeYaml, FileTypeJson:
+		return parseTreeDocument(data, fileType == FileTypeJson)
+	case FileTypeIni:
+		return parseIniDocument(data)
+	}
+
+	return nil, fmt.Errorf("unsupported file type: %s", fileType)
+}
+
+// dotenvDocument is a flat dotenv file. The keys keep the order of the
+// file and new keys are added at the end.
+type dotenvDocument struct {
+	keys []string
+	data map[string]string
+}
+
+// parseDotenvDocument parses the values with godotenv and reads the
+// order of the keys from the lines of the file.
+func parseDotenvDocument(data []byte) (*dotenvDocument, error) {
+	kv, err := godotenv.UnmarshalBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dotenvDocument{data: kv}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.IndexAny(line, "=:")
+		if i < 1 {
+			continue
+		}
+
+		key := strings.TrimSpace(line[:i])
+		if _, ok := kv[key]; ok && !seen[key] {
+			seen[key] = true
+			d.keys = append(d.keys, key)
+		}
+	}
+
+	// keys of lines that are not KEY=VALUE e.g. inside multiline values.
+	rest := []string{}
+	for k := range kv {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+
+	sort.Strings(rest)
+	d.keys = append(d.keys, rest...)
+	return d, nil
+}
+
+func (d *dotenvDocument) Get(key string) (string, error) {
+	v, ok := d.data[key]
+	if !ok {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+
+	return v, nil
+}
+
+func (d *dotenvDocument) Set(key, value string) error {
+	if _, ok := d.data[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+
+	d.data[key] = value
+	return nil
+}
+
+func (d *dotenvDocument) Delete(key string) bool {
+	if _, ok := d.data[key]; !ok {
+		return false
+	}
+
+	delete(d.data, key)
+	d.keys = slices.DeleteFunc(d.keys, func(k string) bool { return k == key })
+	return true
+}
+
+func (d *dotenvDocument) Keys() []string {
+	return slices.Clone(d.keys)
+}
+
+// Marshal writes the lines in the order of the keys. Each line is
+// quoted by godotenv.
+func (d *dotenvDocument) Marshal(indent int) ([]byte, error) {
+	b := &strings.Builder{}
+	for _, k := range d.keys {
+		line, err := godotenv.Marshal(map[string]string{k: d.data[k]})
+		if err != nil {
+			return nil, err
+		}
+
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	return []byte(b.String()), nil
+}
+
+// loadDocument sets the leaf values of the nested maps of data in the
+// document in key order.
+func loadDocument(doc document, fileType string, data map[string]interface{}) error {
+	values := map[string]string{}
+	flatten("", data, values)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		err := doc.Set(normalizeKey(k, fileType), values[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flatten returns the leaf values of nested maps by their dotted paths.
+func flatten(prefix string, data map[string]interface{}, values map[string]string) {
+	for k, v := range data {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flatten(key, v, values)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package sops_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/vaults/sops"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSops puts a sops script on the path that prints the file as is
+// on decrypt and encrypt.
+func fakeSops(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\ncat \"$last\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sops"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDetectFileType(t *testing.T) {
+	assert.Equal(t, sops.FileTypeDotenv, sops.DetectFileType("/app/.env"))
+	assert.Equal(t, sops.FileTypeYaml, sops.DetectFileType("secrets.yml"))
+	assert.Equal(t, sops.FileTypeJson, sops.DetectFileType("secrets.JSON"))
+	assert.Equal(t, sops.FileTypeIni, sops.DetectFileType("secrets.ini"))
+}
+
+func TestSopsYamlFile(t *testing.T) {
+	fakeSops(t)
+	file := filepath.Join(t.TempDir(), "secrets.yaml")
+	content := `# app secrets
+app:
+  name: web
+db:
+  password: old
+  port: 5432
+tokens:
+  - a
+  - b
+`
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	vault := sops.New(sops.SopsSecretVaultParams{File: file})
+	v, err := vault.GetSecretValue("db.password", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", v)
+
+	v, err = vault.GetSecretValue("tokens/1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", v)
+
+	_, err = vault.GetSecretValue("db", nil)
+	assert.ErrorContains(t, err, "not a value")
+
+	names, err := vault.ListSecretNames(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app.name", "db.password", "db.port", "tokens.0", "tokens.1"}, names)
+
+	assert.NoError(t, vault.BatchSetSecretValues(map[string]string{
+		"db/password": "new",
+		"db.port":     "5433",
+		"cache.url":   "redis://cache",
+	}, nil))
+	assert.NoError(t, vault.DeleteSecret("app.name", nil))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, `# app secrets
+app: {}
+db:
+  password: new
+  port: 5433
+tokens:
+  - a
+  - b
+cache:
+  url: redis://cache
+`, string(data))
+}
+
+func TestSopsJsonFile(t *testing.T) {
+	fakeSops(t)
+	file := filepath.Join(t.TempDir(), "secrets.json")
+	content := `{"db": {"user": "app", "password": "old", "port": 5432, "tls": true}, "api_key": "k<1>"}`
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	vault := sops.New(sops.SopsSecretVaultParams{File: file})
+	v, err := vault.GetSecretValue("api_key", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "k<1>", v)
+
+	assert.NoError(t, vault.SetSecretValue("db.password", "new", nil))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "db": {
+    "user": "app",
+    "password": "new",
+    "port": 5432,
+    "tls": true
+  },
+  "api_key": "k<1>"
+}
+`, string(data))
+}
+
+func TestSopsDotenvFile(t *testing.T) {
+	fakeSops(t)
+	file := filepath.Join(t.TempDir(), "secrets.env")
+	content := "ZED=last\nAPP_NAME=web\nDB_PASSWORD=old\n"
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	vault := sops.New(sops.SopsSecretVaultParams{File: file})
+	names, err := vault.ListSecretNames(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ZED", "APP_NAME", "DB_PASSWORD"}, names)
+
+	assert.NoError(t, vault.SetSecretValue("DB_PASSWORD", "new", nil))
+	assert.NoError(t, vault.SetSecretValue("CACHE_URL", "redis://cache", nil))
+	assert.NoError(t, vault.DeleteSecret("APP_NAME", nil))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "ZED=\"last\"\nDB_PASSWORD=\"new\"\nCACHE_URL=\"redis://cache\"\n", string(data))
+}
+
+func TestSopsIniFile(t *testing.T) {
+	fakeSops(t)
+	file := filepath.Join(t.TempDir(), "secrets.ini")
+	content := "token = abc\n\n[db]\npassword = old\nuser = app\n"
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	vault := sops.New(sops.SopsSecretVaultParams{File: file})
+	v, err := vault.GetSecretValue("db/password", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", v)
+
+	v, err = vault.GetSecretValue("token", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", v)
+
+	assert.NoError(t, vault.SetSecretValue("db.password", "new", nil))
+	assert.NoError(t, vault.SetSecretValue("cache.url", "redis://cache", nil))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "token = abc\n\n[db]\npassword = new\nuser = app\n\n[cache]\nurl = redis://cache\n", string(data))
+}
+
+func TestSopsEncryptFailureKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\nif [ \"$1\" = decrypt ]; then cat \"$last\"; exit 0; fi\necho failed >&2\nexit 1\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sops"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	file := filepath.Join(t.TempDir(), "secrets.env")
+	assert.NoError(t, os.WriteFile(file, []byte("TOKEN=encrypted\n"), 0600))
+
+	vault := sops.New(sops.SopsSecretVaultParams{File: file})
+	err := vault.SetSecretValue("TOKEN", "plaintext", nil)
+	assert.ErrorContains(t, err, "failed")
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "TOKEN=encrypted\n", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(file))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSopsDrivers(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args")
+	script := "#!/bin/sh\nfor last; do :; done\necho \"$* AWS_PROFILE=$AWS_PROFILE\" >> " + log + "\ncat \"$last\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sops"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	file := filepath.Join(t.TempDir(), "secrets.env")
+	assert.NoError(t, os.WriteFile(file, []byte("TOKEN=old\n"), 0600))
+	vault := sops.New(sops.SopsSecretVaultParams{
+		File:   file,
+		Driver: "aws",
+		Kms: &sops.SopsKmsParams{
+			Uri:               "arn:aws:kms:us-east-1:1:key/a",
+			AwsProfile:        "deploy",
+			EncryptionContext: "app:web",
+		},
+	})
+	assert.NoError(t, vault.SetSecretValue("TOKEN", "abc", nil))
+
+	vault = sops.New(sops.SopsSecretVaultParams{File: file, Driver: "vault", VaultUri: "https://vault/v1/transit/keys/app"})
+	assert.NoError(t, vault.SetSecretValue("TOKEN", "abc", nil))
+
+	data, err := os.ReadFile(log)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[0], "decrypt "))
+	assert.Contains(t, lines[0], "AWS_PROFILE=deploy")
+	assert.Contains(t, lines[1], "--kms arn:aws:kms:us-east-1:1:key/a --aws-profile deploy --encryption-context app:web")
+	assert.Contains(t, lines[3], "--hc-vault-transit https://vault/v1/transit/keys/app")
+
+	_, err = sops.DriverName("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,199 @@
+package sops
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// iniDocument is an ini file. Keys are section.key and keys outside of
+// a section or in the DEFAULT section have no section.
+type iniDocument struct {
+	sections []*iniSection
+}
+
+type iniSection struct {
+	name   string
+	keys   []string
+	values map[string]string
+}
+
+func parseIniDocument(data []byte) (*iniDocument, error) {
+	d := &iniDocument{}
+	var section *iniSection
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = d.section(strings.TrimSpace(line[1:len(line)-1]), true)
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid ini line %d", n)
+		}
+
+		if section == nil {
+			section = d.section("", true)
+		}
+
+		section.set(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+	}
+
+	return d, scanner.Err()
+}
+
+func (d *iniDocument) Get(key string) (string, error) {
+	s, k := d.find(key)
+	if s == nil {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+
+	return s.values[k], nil
+}
+
+func (d *iniDocument) Set(key, value string) error {
+	s, k := d.find(key)
+	if s != nil {
+		s.values[k] = value
+		return nil
+	}
+
+	name, k := splitIniKey(key)
+	if name == "" && d.section("", false) == nil && d.section("DEFAULT", false) != nil {
+		name = "DEFAULT"
+	}
+
+	d.section(name, true).set(k, value)
+	return nil
+}
+
+func (d *iniDocument) Delete(key string) bool {
+	s, k := d.find(key)
+	if s == nil {
+		return false
+	}
+
+	delete(s.values, k)
+	for i, sk := range s.keys {
+		if sk == k {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+func (d *iniDocument) Keys() []string {
+	keys := []string{}
+	for _, s := range d.sections {
+		for _, k := range s.keys {
+			if s.name == "" || s.name == "DEFAULT" {
+				keys = append(keys, k)
+				continue
+			}
+
+			keys = append(keys, s.name+"."+k)
+		}
+	}
+
+	return keys
+}
+
+func (d *iniDocument) Marshal(indent int) ([]byte, error) {
+	b := &bytes.Buffer{}
+	for _, s := range d.sections {
+		if len(s.keys) == 0 {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+
+		if s.name != "" {
+			fmt.Fprintf(b, "[%s]\n", s.name)
+		}
+
+		for _, k := range s.keys {
+			fmt.Fprintf(b, "%s = %s\n", k, s.values[k])
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// find returns the section and key of a key. Keys without a section
+// are looked up outside of sections and in the DEFAULT section.
+func (d *iniDocument) find(key string) (*iniSection, string) {
+	for _, name := range []string{"", "DEFAULT"} {
+		if s := d.section(name, false); s != nil && s.has(key) {
+			return s, key
+		}
+	}
+
+	name, k := splitIniKey(key)
+	if name == "" {
+		return nil, ""
+	}
+
+	if s := d.section(name, false); s != nil && s.has(k) {
+		return s, k
+	}
+
+	return nil, ""
+}
+
+func (d *iniDocument) section(name string, create bool) *iniSection {
+	for _, s := range d.sections {
+		if s.name == name {
+			return s
+		}
+	}
+
+	if !create {
+		return nil
+	}
+
+	s := &iniSection{name: name, values: map[string]string{}}
+	if name == "" {
+		d.sections = append([]*iniSection{s}, d.sections...)
+	} else {
+		d.sections = append(d.sections, s)
+	}
+
+	return s
+}
+
+func (s *iniSection) has(key string) bool {
+	_, ok := s.values[key]
+	return ok
+}
+
+func (s *iniSection) set(key, value string) {
+	if !s.has(key) {
+		s.keys = append(s.keys, key)
+	}
+
+	s.values[key] = value
+}
+
+// splitIniKey splits the key into the section and the key at the first
+// separator e.g. db.password or db/password.
+func splitIniKey(key string) (string, string) {
+	i := strings.IndexAny(key, "./:")
+	if i < 0 {
+		return "", key
+	}
+
+	return key[:i], key[i+1:]
+}
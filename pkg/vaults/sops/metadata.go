@@ -0,0 +1,327 @@
+package sops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	metadataKey    = "sops"
+	dotenvPrefix   = "sops_"
+	sopsVersion    = "3.9.0"
+	defaultSuffix  = "_unencrypted"
+	sopsConfigFile = ".sops.yaml"
+)
+
+// metadata is the sops key of an encrypted file. Only age keys are
+// supported by the native vault.
+type metadata struct {
+	Age               []ageStanza `yaml:"age,omitempty"`
+	LastModified      string      `yaml:"lastmodified"`
+	Mac               string      `yaml:"mac"`
+	UnencryptedSuffix string      `yaml:"unencrypted_suffix,omitempty"`
+	EncryptedSuffix   string      `yaml:"encrypted_suffix,omitempty"`
+	UnencryptedRegex  string      `yaml:"unencrypted_regex,omitempty"`
+	EncryptedRegex    string      `yaml:"encrypted_regex,omitempty"`
+	MacOnlyEncrypted  bool        `yaml:"mac_only_encrypted,omitempty"`
+	Version           string      `yaml:"version"`
+
+	unencryptedRegex *regexp.Regexp
+	encryptedRegex   *regexp.Regexp
+}
+
+type ageStanza struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// compile compiles the regex options of the metadata.
+func (m *metadata) compile() error {
+	var err error
+	if m.UnencryptedRegex != "" {
+		m.unencryptedRegex, err = regexp.Compile(m.UnencryptedRegex)
+		if err != nil {
+			return fmt.Errorf("invalid unencrypted_regex: %w", err)
+		}
+	}
+
+	if m.EncryptedRegex != "" {
+		m.encryptedRegex, err = regexp.Compile(m.EncryptedRegex)
+		if err != nil {
+			return fmt.Errorf("invalid encrypted_regex: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// shouldEncrypt returns true when the value at the path is encrypted,
+// using the same rules as sops.
+func (m *metadata) shouldEncrypt(path []string) bool {
+	encrypted := true
+	if m.UnencryptedSuffix != "" {
+		for _, p := range path {
+			if strings.HasSuffix(p, m.UnencryptedSuffix) {
+				encrypted = false
+				break
+			}
+		}
+	}
+
+	if m.EncryptedSuffix != "" {
+		encrypted = false
+		for _, p := range path {
+			if strings.HasSuffix(p, m.EncryptedSuffix) {
+				encrypted = true
+				break
+			}
+		}
+	}
+
+	if m.unencryptedRegex != nil {
+		for _, p := range path {
+			if m.unencryptedRegex.MatchString(p) {
+				encrypted = false
+				break
+			}
+		}
+	}
+
+	if m.encryptedRegex != nil {
+		encrypted = false
+		for _, p := range path {
+			if m.encryptedRegex.MatchString(p) {
+				encrypted = true
+				break
+			}
+		}
+	}
+
+	return encrypted
+}
+
+// node returns the metadata as a yaml mapping.
+func (m *metadata) node() (*yaml.Node, error) {
+	n := &yaml.Node{}
+	err := n.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// sops writes the armored keys as literal blocks.
+	for _, s := range n.Content {
+		setLiteral(s)
+	}
+
+	return n, nil
+}
+
+func setLiteral(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "\n") {
+		n.Style = yaml.LiteralStyle
+	}
+
+	for _, c := range n.Content {
+		setLiteral(c)
+	}
+}
+
+// takeMetadata removes the sops key from the root of the document and
+// returns its metadata.
+func takeMetadata(root *yaml.Node) (*metadata, error) {
+	n := mapValue(root, metadataKey)
+	if n == nil {
+		return nil, fmt.Errorf("sops metadata not found")
+	}
+
+	m := &metadata{}
+	err := n.Decode(m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sops metadata: %w", err)
+	}
+
+	removePair(root, metadataKey)
+	return m, nil
+}
+
+// parseDotenvMetadata reads the flattened sops_ keys of a dotenv file
+// e.g. sops_age__list_0__map_recipient.
+func parseDotenvMetadata(values map[string]string) (*metadata, error) {
+	m := &metadata{}
+	found := false
+	for k, v := range values {
+		if !strings.HasPrefix(k, dotenvPrefix) {
+			continue
+		}
+
+		found = true
+		name := strings.TrimPrefix(k, dotenvPrefix)
+		if strings.HasPrefix(name, "age__list_") {
+			rest := strings.TrimPrefix(name, "age__list_")
+			i := strings.Index(rest, "__map_")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid sops metadata key %s", k)
+			}
+
+			n, err := strconv.Atoi(rest[:i])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid sops metadata key %s", k)
+			}
+
+			for len(m.Age) <= n {
+				m.Age = append(m.Age, ageStanza{})
+			}
+
+			switch rest[i+len("__map_"):] {
+			case "recipient":
+				m.Age[n].Recipient = v
+			case "enc":
+				m.Age[n].Enc = v
+			}
+
+			continue
+		}
+
+		switch name {
+		case "lastmodified":
+			m.LastModified = v
+		case "mac":
+			m.Mac = v
+		case "unencrypted_suffix":
+			m.UnencryptedSuffix = v
+		case "encrypted_suffix":
+			m.EncryptedSuffix = v
+		case "unencrypted_regex":
+			m.UnencryptedRegex = v
+		case "encrypted_regex":
+			m.EncryptedRegex = v
+		case "mac_only_encrypted":
+			m.MacOnlyEncrypted = v == "true"
+		case "version":
+			m.Version = v
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("sops metadata not found")
+	}
+
+	return m, nil
+}
+
+// dotenvLines returns the metadata as sorted sops_ dotenv lines.
+func (m *metadata) dotenvLines() []string {
+	values := map[string]string{
+		"lastmodified": m.LastModified,
+		"mac":          m.Mac,
+		"version":      m.Version,
+	}
+
+	for i, s := range m.Age {
+		values[fmt.Sprintf("age__list_%d__map_recipient", i)] = s.Recipient
+		values[fmt.Sprintf("age__list_%d__map_enc", i)] = s.Enc
+	}
+
+	optional := map[string]string{
+		"unencrypted_suffix": m.UnencryptedSuffix,
+		"encrypted_suffix":   m.EncryptedSuffix,
+		"unencrypted_regex":  m.UnencryptedRegex,
+		"encrypted_regex":    m.EncryptedRegex,
+	}
+
+	for k, v := range optional {
+		if v != "" {
+			values[k] = v
+		}
+	}
+
+	if m.MacOnlyEncrypted {
+		values["mac_only_encrypted"] = "true"
+	}
+
+	lines := make([]string, 0, len(values))
+	for k, v := range values {
+		lines = append(lines, dotenvPrefix+k+"="+escapeDotenv(v))
+	}
+
+	sort.Strings(lines)
+	return lines
+}
+
+// creationRule is a creation rule of a .sops.yaml file.
+type creationRule struct {
+	PathRegex         string `yaml:"path_regex"`
+	Age               string `yaml:"age"`
+	UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+	EncryptedSuffix   string `yaml:"encrypted_suffix"`
+	UnencryptedRegex  string `yaml:"unencrypted_regex"`
+	EncryptedRegex    string `yaml:"encrypted_regex"`
+	MacOnlyEncrypted  bool   `yaml:"mac_only_encrypted"`
+}
+
+// findCreationRule returns the first creation rule of the config file
+// that matches the file. When configFile is empty, a .sops.yaml file is
+// looked up from the directory of the file upwards. Like sops, the
+// path_regex is matched against the path relative to the config file.
+func findCreationRule(configFile, file string) (*creationRule, error) {
+	if configFile == "" {
+		dir := filepath.Dir(file)
+		for {
+			next := filepath.Join(dir, sopsConfigFile)
+			if _, err := os.Stat(next); err == nil {
+				configFile = next
+				break
+			}
+
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return nil, nil
+			}
+
+			dir = parent
+		}
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := struct {
+		CreationRules []creationRule `yaml:"creation_rules"`
+	}{}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sops config %s: %w", configFile, err)
+	}
+
+	path := file
+	if rel, err := filepath.Rel(filepath.Dir(configFile), file); err == nil {
+		path = rel
+	}
+
+	for _, r := range config.CreationRules {
+		if r.PathRegex == "" {
+			return &r, nil
+		}
+
+		re, err := regexp.Compile(r.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_regex in %s: %w", configFile, err)
+		}
+
+		if re.MatchString(filepath.ToSlash(path)) {
+			return &r, nil
+		}
+	}
+
+	return nil, nil
+}
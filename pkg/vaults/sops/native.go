@@ -0,0 +1,730 @@
+package sops
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/jolt9dev/j9d/pkg/env"
+	"github.com/jolt9dev/j9d/pkg/vaults"
+	"gopkg.in/yaml.v3"
+)
+
+// SopsNativeSecretVault reads and writes age encrypted sops files
+// without the sops binary. The decrypted values are only kept in memory.
+type SopsNativeSecretVault struct {
+	params   SopsSecretVaultParams
+	fileType string
+	doc      *treeDocument
+	meta     *metadata
+	dataKey  []byte
+	loaded   bool
+}
+
+var _ vaults.SecretVault = (*SopsNativeSecretVault)(nil)
+
+// NewNative creates a sops vault that encrypts and decrypts the file
+// in-process. Only age keys and dotenv, yaml and json files are
+// supported.
+func NewNative(params SopsSecretVaultParams) *SopsNativeSecretVault {
+	if params.FileType == "" {
+		params.FileType = DetectFileType(params.File)
+	}
+
+	return &SopsNativeSecretVault{
+		params:   params,
+		fileType: params.FileType,
+	}
+}
+
+// LoadData replaces the secrets with the data. Nested maps are stored
+// as nested values in yaml and json files.
+func (s *SopsNativeSecretVault) LoadData(data map[string]interface{}) error {
+	err := s.checkFileType()
+	if err != nil {
+		return err
+	}
+
+	doc := newTreeDocument(s.fileType == FileTypeJson)
+	err = loadDocument(doc, s.fileType, data)
+	if err != nil {
+		return err
+	}
+
+	s.doc = doc
+	s.loaded = true
+	return nil
+}
+
+func (s *SopsNativeSecretVault) GetSecretValue(key string, params *vaults.GetSecretValueParams) (string, error) {
+	if !s.loaded {
+		err := s.Decrypt()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return s.doc.Get(normalizeKey(key, s.fileType))
+}
+
+func (s *SopsNativeSecretVault) ListSecretNames(params *vaults.ListSecretNamesParams) ([]string, error) {
+	if !s.loaded {
+		err := s.Decrypt()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.doc.Keys(), nil
+}
+
+func (s *SopsNativeSecretVault) BatchGetSecretValues(keys []string, params *vaults.GetSecretValueParams) (map[string]string, error) {
+	return batchGetSecretValues(s, keys, params)
+}
+
+func (s *SopsNativeSecretVault) MapSecretValues(query map[string]string, params *vaults.GetSecretValueParams) (map[string]string, error) {
+	return mapSecretValues(s, query, params)
+}
+
+func (s *SopsNativeSecretVault) SetSecretValue(key, value string, params *vaults.SetSecretValueParams) error {
+	err := s.setSecretValue(key, value)
+	if err != nil {
+		return err
+	}
+
+	return s.Encrypt()
+}
+
+func (s *SopsNativeSecretVault) BatchSetSecretValues(values map[string]string, params *vaults.SetSecretValueParams) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	for k, v := range values {
+		err := s.setSecretValue(k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Encrypt()
+}
+
+func (s *SopsNativeSecretVault) DeleteSecret(key string, params *vaults.DeleteSecretParams) error {
+	if !s.loaded {
+		err := s.Decrypt()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.doc.Delete(normalizeKey(key, s.fileType)) {
+		return s.Encrypt()
+	}
+
+	return nil
+}
+
+// setSecretValue sets the value in memory. A file that does not exist
+// yet is created on the next Encrypt.
+func (s *SopsNativeSecretVault) setSecretValue(key, value string) error {
+	if !s.loaded {
+		if _, err := os.Stat(s.params.File); os.IsNotExist(err) {
+			err = s.LoadData(map[string]interface{}{})
+			if err != nil {
+				return err
+			}
+		} else {
+			err = s.Decrypt()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.doc.Set(normalizeKey(key, s.fileType), value)
+}
+
+// Decrypt reads the file, decrypts the data key with the age identities
+// and the values with the data key and verifies the mac of the file.
+func (s *SopsNativeSecretVault) Decrypt() error {
+	err := s.checkFileType()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(s.params.File)
+	if err != nil {
+		return err
+	}
+
+	doc, meta, err := parseEncrypted(s.fileType, data)
+	if err != nil {
+		return fmt.Errorf("error parsing %s file %s: %w", s.fileType, s.params.File, err)
+	}
+
+	err = meta.compile()
+	if err != nil {
+		return err
+	}
+
+	key, err := s.decryptDataKey(meta)
+	if err != nil {
+		return fmt.Errorf("error decrypting file %s: %w", s.params.File, err)
+	}
+
+	h := newMac(meta)
+	err = walkScalars(doc.root, nil, func(n *yaml.Node, path []string) error {
+		encrypted := meta.shouldEncrypt(path)
+		if !encrypted {
+			if !meta.MacOnlyEncrypted {
+				plain, _ := plainValue(n.Tag, n.Value)
+				h.Write(plain)
+			}
+
+			return nil
+		}
+
+		plain, valueType, err := decryptValue(n.Value, key, aad(path))
+		if err != nil {
+			return err
+		}
+
+		tag, value, err := scalarValue(plain, valueType)
+		if err != nil {
+			return err
+		}
+
+		h.Write(plain)
+		n.Tag = tag
+		n.Value = value
+		n.Style = 0
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error decrypting file %s: %w", s.params.File, err)
+	}
+
+	err = verifyMac(meta, key, h)
+	if err != nil {
+		return fmt.Errorf("error decrypting file %s: %w", s.params.File, err)
+	}
+
+	s.doc = doc
+	s.meta = meta
+	s.dataKey = key
+	s.loaded = true
+	return nil
+}
+
+// Encrypt encrypts a copy of the secrets and replaces the file. The
+// data key of the file is reused, new files get a new data key that is
+// encrypted for the age recipients.
+func (s *SopsNativeSecretVault) Encrypt() error {
+	err := s.checkFileType()
+	if err != nil {
+		return err
+	}
+
+	if s.doc == nil {
+		s.doc = newTreeDocument(s.fileType == FileTypeJson)
+	}
+
+	if s.meta == nil || s.dataKey == nil {
+		meta, key, err := s.newMetadata()
+		if err != nil {
+			return err
+		}
+
+		s.meta = meta
+		s.dataKey = key
+	}
+
+	meta := *s.meta
+	root := copyNode(s.doc.root)
+	h := newMac(&meta)
+	err = walkScalars(root, nil, func(n *yaml.Node, path []string) error {
+		plain, valueType := plainValue(n.Tag, n.Value)
+		encrypted := meta.shouldEncrypt(path)
+		if encrypted || !meta.MacOnlyEncrypted {
+			h.Write(plain)
+		}
+
+		if !encrypted {
+			return nil
+		}
+
+		value, err := encryptValue(plain, valueType, s.dataKey, aad(path))
+		if err != nil {
+			return err
+		}
+
+		n.Tag = "!!str"
+		n.Value = value
+		n.Style = 0
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	meta.LastModified = time.Now().UTC().Format(time.RFC3339)
+	meta.Mac, err = encryptValue([]byte(fmt.Sprintf("%X", h.Sum(nil))), "str", s.dataKey, meta.LastModified)
+	if err != nil {
+		return err
+	}
+
+	bits, err := marshalEncrypted(s.fileType, root, &meta, s.params.Indent)
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(s.params.File, bits)
+	if err != nil {
+		return err
+	}
+
+	s.meta = &meta
+	return nil
+}
+
+func (s *SopsNativeSecretVault) checkFileType() error {
+	switch s.fileType {
+	case FileTypeDotenv, FileTypeYaml, FileTypeJson:
+		return nil
+	}
+
+	return fmt.Errorf("the native sops vault does not support %s files, use the sops cli", s.fileType)
+}
+
+// decryptDataKey decrypts the data key with the first age identity
+// that matches a recipient of the file.
+func (s *SopsNativeSecretVault) decryptDataKey(meta *metadata) ([]byte, error) {
+	if len(meta.Age) == 0 {
+		return nil, fmt.Errorf("no age keys found, the native sops vault only supports age")
+	}
+
+	identities, err := s.identities()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stanza := range meta.Age {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(stanza.Enc)), identities...)
+		if err != nil {
+			continue
+		}
+
+		key, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("no age identity found for the recipients of the file")
+}
+
+// identities returns the age identities of the vault params, the
+// SOPS_AGE_KEY and SOPS_AGE_KEY_FILE variables and the default sops
+// keys file.
+func (s *SopsNativeSecretVault) identities() ([]age.Identity, error) {
+	keys := []string{}
+	files := []string{}
+	if s.params.Age != nil {
+		keys = append(keys, s.params.Age.Key)
+		files = append(files, s.params.Age.KeyFile)
+	}
+
+	keys = append(keys, env.Get("SOPS_AGE_KEY"))
+	files = append(files, env.Get("SOPS_AGE_KEY_FILE"))
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "sops", "age", "keys.txt"))
+	}
+
+	identities := []age.Identity{}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		ids, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age key: %w", err)
+		}
+
+		identities = append(identities, ids...)
+	}
+
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		ids, err := age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age key file %s: %w", file, err)
+		}
+
+		identities = append(identities, ids...)
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identities found")
+	}
+
+	return identities, nil
+}
+
+// newMetadata creates the metadata and data key of a new file. The
+// recipients and options come from the vault params, SOPS_AGE_RECIPIENTS
+// or the creation rule of the .sops.yaml file.
+func (s *SopsNativeSecretVault) newMetadata() (*metadata, []byte, error) {
+	rule, err := findCreationRule(s.params.ConfigFile, s.params.File)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rule == nil {
+		rule = &creationRule{}
+	}
+
+	recipients := ""
+	if s.params.Age != nil {
+		recipients = s.params.Age.Recipients
+	}
+
+	if recipients == "" {
+		recipients = env.Get("SOPS_AGE_RECIPIENTS")
+	}
+
+	if recipients == "" {
+		recipients = rule.Age
+	}
+
+	meta := &metadata{
+		UnencryptedSuffix: rule.UnencryptedSuffix,
+		EncryptedSuffix:   rule.EncryptedSuffix,
+		UnencryptedRegex:  rule.UnencryptedRegex,
+		EncryptedRegex:    rule.EncryptedRegex,
+		MacOnlyEncrypted:  rule.MacOnlyEncrypted,
+		Version:           sopsVersion,
+	}
+
+	if meta.UnencryptedSuffix == "" && meta.EncryptedSuffix == "" && meta.UnencryptedRegex == "" && meta.EncryptedRegex == "" {
+		meta.UnencryptedSuffix = defaultSuffix
+	}
+
+	err = meta.compile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, r := range strings.Split(recipients, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		stanza, err := encryptDataKey(key, r)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		meta.Age = append(meta.Age, *stanza)
+	}
+
+	if len(meta.Age) == 0 {
+		return nil, nil, fmt.Errorf("no age recipients found for sops file %s", s.params.File)
+	}
+
+	return meta, key, nil
+}
+
+func encryptDataKey(key []byte, recipient string) (*ageStanza, error) {
+	r, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %s: %w", recipient, err)
+	}
+
+	b := &bytes.Buffer{}
+	aw := armor.NewWriter(b)
+	w, err := age.Encrypt(aw, r)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = aw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ageStanza{Recipient: recipient, Enc: b.String()}, nil
+}
+
+// macOnlyEncryptedInit seeds the mac of files with mac_only_encrypted so
+// it differs from the mac over all values. It is sha256("sops").
+var macOnlyEncryptedInit = []byte{
+	0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0x0b,
+	0x0b, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69,
+}
+
+// newMac returns the hash of the plaintext values that sops stores as
+// the mac of the file.
+func newMac(meta *metadata) hash.Hash {
+	h := sha512.New()
+	if meta.MacOnlyEncrypted {
+		h.Write(macOnlyEncryptedInit)
+	}
+
+	return h
+}
+
+func verifyMac(meta *metadata, key []byte, h hash.Hash) error {
+	modified, err := time.Parse(time.RFC3339, meta.LastModified)
+	if err != nil {
+		return fmt.Errorf("invalid lastmodified: %w", err)
+	}
+
+	mac, _, err := decryptValue(meta.Mac, key, modified.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("unable to decrypt mac: %w", err)
+	}
+
+	if string(mac) != fmt.Sprintf("%X", h.Sum(nil)) {
+		return fmt.Errorf("mac mismatch, the file was modified")
+	}
+
+	return nil
+}
+
+// aad returns the additional data of the value at the path.
+func aad(path []string) string {
+	return strings.Join(path, ":") + ":"
+}
+
+// walkScalars calls fn for each value of the tree with the path of map
+// keys to the value. Items of sequences do not add to the path.
+func walkScalars(n *yaml.Node, path []string, fn func(n *yaml.Node, path []string) error) error {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			next := append(append([]string{}, path...), n.Content[i].Value)
+			err := walkScalars(n.Content[i+1], next, fn)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			err := walkScalars(c, path, fn)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return nil
+		}
+
+		return fn(n, path)
+	}
+
+	return nil
+}
+
+// copyNode copies the tree. Comments that are not encrypted are left
+// out so that no plaintext is written to the file.
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.HeadComment = encryptedComment(n.HeadComment)
+	c.LineComment = encryptedComment(n.LineComment)
+	c.FootComment = encryptedComment(n.FootComment)
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+
+	return &c
+}
+
+func encryptedComment(comment string) string {
+	for _, line := range strings.Split(comment, "\n") {
+		if !isEncrypted(strings.TrimSpace(strings.TrimPrefix(line, "#"))) {
+			return ""
+		}
+	}
+
+	return comment
+}
+
+// parseEncrypted returns the encrypted values and the metadata of a
+// sops file.
+func parseEncrypted(fileType string, data []byte) (*treeDocument, *metadata, error) {
+	if fileType == FileTypeDotenv {
+		doc := newTreeDocument(false)
+		values := map[string]string{}
+		keys, err := parseDotenv(data, values)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, k := range keys {
+			if strings.HasPrefix(k, dotenvPrefix) {
+				continue
+			}
+
+			appendPair(doc.root, k, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: values[k]})
+		}
+
+		meta, err := parseDotenvMetadata(values)
+		return doc, meta, err
+	}
+
+	doc, err := parseTreeDocument(data, fileType == FileTypeJson)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, err := takeMetadata(doc.root)
+	return doc, meta, err
+}
+
+// marshalEncrypted writes the encrypted values and the metadata in the
+// format of the file type.
+func marshalEncrypted(fileType string, root *yaml.Node, meta *metadata, indent int) ([]byte, error) {
+	if fileType == FileTypeDotenv {
+		b := &bytes.Buffer{}
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			fmt.Fprintf(b, "%s=%s\n", root.Content[i].Value, escapeDotenv(root.Content[i+1].Value))
+		}
+
+		for _, line := range meta.dotenvLines() {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+
+		return b.Bytes(), nil
+	}
+
+	n, err := meta.node()
+	if err != nil {
+		return nil, err
+	}
+
+	appendPair(root, metadataKey, n)
+	doc := &treeDocument{root: root, json: fileType == FileTypeJson}
+	return doc.Marshal(indent)
+}
+
+// parseDotenv parses the KEY=VALUE lines of a sops dotenv file. Values
+// are not quoted and newlines are escaped as \n.
+func parseDotenv(data []byte, values map[string]string) ([]string, error) {
+	keys := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid dotenv line %d", n)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		values[key] = strings.ReplaceAll(line[i+1:], "\\n", "\n")
+	}
+
+	return keys, scanner.Err()
+}
+
+func escapeDotenv(value string) string {
+	return strings.ReplaceAll(value, "\n", "\\n")
+}
+
+// writeFile replaces the file with a temp file in the same directory so
+// that the file is never left partially written.
+func writeFile(file string, data []byte) error {
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(file); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	dir := filepath.Dir(file)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
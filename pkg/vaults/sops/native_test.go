@@ -0,0 +1,226 @@
+package sops_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/jolt9dev/j9d/pkg/vaults/sops"
+	"github.com/stretchr/testify/assert"
+)
+
+// nativeVault returns a native vault for a new file with a generated
+// age identity.
+func nativeVault(t *testing.T, name string) (*sops.SopsNativeSecretVault, sops.SopsSecretVaultParams) {
+	id, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+
+	t.Setenv("SOPS_AGE_KEY", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	t.Setenv("SOPS_AGE_RECIPIENTS", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	params := sops.SopsSecretVaultParams{
+		File: filepath.Join(t.TempDir(), name),
+		Age: &sops.SopsAgeParams{
+			Recipients: id.Recipient().String(),
+			Key:        id.String(),
+		},
+	}
+
+	return sops.NewNative(params), params
+}
+
+func TestNativeVaultRoundTrip(t *testing.T) {
+	for _, name := range []string{"secrets.yaml", "secrets.json", ".env"} {
+		t.Run(name, func(t *testing.T) {
+			vault, params := nativeVault(t, name)
+			assert.NoError(t, vault.BatchSetSecretValues(map[string]string{
+				"db.password": "s3cr3t",
+				"db.port":     "5432",
+				"multi":       "line1\nline2",
+			}, nil))
+
+			data, err := os.ReadFile(params.File)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(data), "s3cr3t")
+			assert.NotContains(t, string(data), "line1")
+			assert.Contains(t, string(data), "ENC[AES256_GCM,data:")
+
+			fi, err := os.Stat(params.File)
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+			next := sops.NewNative(params)
+			v, err := next.GetSecretValue("db.password", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "s3cr3t", v)
+
+			v, err = next.GetSecretValue("db/port", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "5432", v)
+
+			v, err = next.GetSecretValue("multi", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "line1\nline2", v)
+
+			assert.NoError(t, next.DeleteSecret("multi", nil))
+			names, err := sops.NewNative(params).ListSecretNames(nil)
+			assert.NoError(t, err)
+			if name == ".env" {
+				assert.ElementsMatch(t, []string{"db_password", "db_port"}, names)
+			} else {
+				assert.ElementsMatch(t, []string{"db.password", "db.port"}, names)
+			}
+		})
+	}
+}
+
+func TestNativeVaultUnencryptedSuffix(t *testing.T) {
+	vault, params := nativeVault(t, "secrets.yaml")
+	assert.NoError(t, vault.LoadData(map[string]interface{}{
+		"api": map[string]interface{}{
+			"url_unencrypted": "https://example.com",
+			"token":           "abc123",
+		},
+	}))
+	assert.NoError(t, vault.Encrypt())
+
+	data, err := os.ReadFile(params.File)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "url_unencrypted: https://example.com")
+	assert.NotContains(t, string(data), "abc123")
+	assert.Contains(t, string(data), "unencrypted_suffix: _unencrypted")
+
+	v, err := sops.NewNative(params).GetSecretValue("api.token", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", v)
+}
+
+func TestNativeVaultMacMismatch(t *testing.T) {
+	vault, params := nativeVault(t, "secrets.yaml")
+	assert.NoError(t, vault.SetSecretValue("token", "abc123", nil))
+	assert.NoError(t, vault.SetSecretValue("note_unencrypted", "hello", nil))
+
+	data, err := os.ReadFile(params.File)
+	assert.NoError(t, err)
+	tampered := strings.Replace(string(data), "note_unencrypted: hello", "note_unencrypted: changed", 1)
+	assert.NotEqual(t, string(data), tampered)
+	assert.NoError(t, os.WriteFile(params.File, []byte(tampered), 0600))
+
+	_, err = sops.NewNative(params).GetSecretValue("token", nil)
+	assert.ErrorContains(t, err, "mac mismatch")
+}
+
+func TestNativeVaultWrongKey(t *testing.T) {
+	vault, params := nativeVault(t, "secrets.yaml")
+	assert.NoError(t, vault.SetSecretValue("token", "abc123", nil))
+
+	other, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	params.Age.Key = other.String()
+
+	_, err = sops.NewNative(params).GetSecretValue("token", nil)
+	assert.ErrorContains(t, err, "no age identity found")
+}
+
+func TestNativeVaultIni(t *testing.T) {
+	vault, _ := nativeVault(t, "secrets.ini")
+	err := vault.SetSecretValue("db.password", "abc", nil)
+	assert.ErrorContains(t, err, "does not support ini files")
+}
+
+// fixtureVault returns a native vault for a copy of a testdata file
+// that was encrypted by sops with the testdata age key.
+func fixtureVault(t *testing.T, name string) (*sops.SopsNativeSecretVault, sops.SopsSecretVaultParams) {
+	key, err := os.ReadFile(filepath.Join("testdata", "age.key"))
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	assert.NoError(t, err)
+
+	t.Setenv("SOPS_AGE_KEY", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	t.Setenv("SOPS_AGE_RECIPIENTS", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	file := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(file, data, 0600))
+
+	params := sops.SopsSecretVaultParams{
+		File: file,
+		Age: &sops.SopsAgeParams{
+			Key: string(key),
+		},
+	}
+
+	return sops.NewNative(params), params
+}
+
+var fixtureValues = map[string]map[string]string{
+	// mac_only_encrypted, unencrypted suffix, nested keys, sequences and bools
+	"secrets.yaml": {
+		"db.password":         "s3cr3t",
+		"db.port":             "5432",
+		"db.tls":              "true",
+		"db.host_unencrypted": "db.internal",
+		"debug":               "false",
+	},
+	"secrets.json": {
+		"api.key":     "k<1>",
+		"api.retries": "3",
+		"api.enabled": "true",
+		"ratio":       "0.5",
+	},
+	// flattened sops_ metadata keys and escaped newlines
+	"secrets.env": {
+		"DB_PASSWORD": "s3cr3t",
+		"DB_PORT":     "5432",
+		"MULTI":       "line1\nline2",
+	},
+}
+
+func TestNativeVaultSopsFixtures(t *testing.T) {
+	for name, values := range fixtureValues {
+		t.Run(name, func(t *testing.T) {
+			vault, _ := fixtureVault(t, name)
+			assert.NoError(t, vault.Decrypt())
+
+			for key, want := range values {
+				v, err := vault.GetSecretValue(key, nil)
+				assert.NoError(t, err)
+				assert.Equal(t, want, v, key)
+			}
+		})
+	}
+}
+
+func TestNativeVaultSopsFixturesReencrypt(t *testing.T) {
+	for name, values := range fixtureValues {
+		t.Run(name, func(t *testing.T) {
+			vault, params := fixtureVault(t, name)
+			assert.NoError(t, vault.SetSecretValue("added", "new value", nil))
+
+			data, err := os.ReadFile(params.File)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(data), "new value")
+			if name == "secrets.yaml" {
+				assert.Contains(t, string(data), "mac_only_encrypted: true")
+			}
+
+			next := sops.NewNative(params)
+			assert.NoError(t, next.Decrypt())
+
+			v, err := next.GetSecretValue("added", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "new value", v)
+
+			for key, want := range values {
+				v, err := next.GetSecretValue(key, nil)
+				assert.NoError(t, err)
+				assert.Equal(t, want, v, key)
+			}
+		})
+	}
+}
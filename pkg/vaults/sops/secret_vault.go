@@ -7,17 +7,17 @@ import (
 	"strings"
 	"unicode"
 
-	"github.com/joho/godotenv"
+	"github.com/jolt9dev/j9d/pkg/logs"
 	"github.com/jolt9dev/j9d/pkg/vaults"
 	"github.com/jolt9dev/j9d/pkg/xexec"
-	"github.com/jolt9dev/j9d/pkg/xfs"
 )
 
 type SopsCliSecretVault struct {
-	params   SopsSecretVaultParams
-	fileType string
-	data     map[string]interface{}
-	loaded   bool
+	params    SopsSecretVaultParams
+	fileType  string
+	doc       document
+	loaded    bool
+	driverErr error
 }
 
 type SopsAgeParams struct {
@@ -36,6 +36,7 @@ type SopsSecretVaultParams struct {
 	File       string
 	ConfigFile string
 	Age        *SopsAgeParams
+	Kms        *SopsKmsParams
 	KmsArns    string
 	// the URI for the azure key vault and the key name
 	AzureKvUri string
@@ -43,31 +44,47 @@ type SopsSecretVaultParams struct {
 	VaultUri        string
 	GcpKmsUri       string
 	PgpFingerprints string
-	Driver          string
-	Indent          int
+	// Driver is age, kms, gcp-kms, azure-kv, hc-vault-transit or pgp.
+	// Aliases such as aws or vault are accepted.
+	Driver string
+	Indent int
+
+	// FileType is dotenv, yaml, json or ini. Detected from the file
+	// extension when empty.
+	FileType string
 }
 
 func New(params SopsSecretVaultParams) *SopsCliSecretVault {
-	if params.Driver == "" {
-		params.Driver = "age"
+	driver, err := DriverName(params.Driver)
+	params.Driver = driver
+
+	if params.FileType == "" {
+		params.FileType = DetectFileType(params.File)
 	}
 
 	return &SopsCliSecretVault{
-		params:   params,
-		fileType: "dotenv",
+		params:    params,
+		fileType:  params.FileType,
+		driverErr: err,
 	}
 }
 
-func init() {
-	x := New(SopsSecretVaultParams{})
-	var v vaults.SecretVault
-	v = x
-
-	println(v)
-}
+var _ vaults.SecretVault = (*SopsCliSecretVault)(nil)
 
+// LoadData replaces the secrets with the data. Nested maps are stored
+// as nested values in yaml, json and ini files.
 func (s *SopsCliSecretVault) LoadData(data map[string]interface{}) error {
-	s.data = data
+	doc, err := newDocument(s.fileType)
+	if err != nil {
+		return err
+	}
+
+	err = loadDocument(doc, s.fileType, data)
+	if err != nil {
+		return err
+	}
+
+	s.doc = doc
 	s.loaded = true
 	return nil
 }
@@ -80,16 +97,7 @@ func (s *SopsCliSecretVault) GetSecretValue(key string, params *vaults.GetSecret
 		}
 	}
 
-	if s.fileType == "dotenv" {
-		key = normalizeKey(key, s.fileType)
-		if v, ok := s.data[key]; ok {
-			return v.(string), nil
-		}
-
-		return "", fmt.Errorf("key not found: %s", key)
-	} else {
-		return "", fmt.Errorf("unsupported file type: %s", s.fileType)
-	}
+	return s.doc.Get(normalizeKey(key, s.fileType))
 }
 
 func (s *SopsCliSecretVault) ListSecretNames(params *vaults.ListSecretNamesParams) ([]string, error) {
@@ -100,51 +108,15 @@ func (s *SopsCliSecretVault) ListSecretNames(params *vaults.ListSecretNamesParam
 		}
 	}
 
-	if s.fileType == "dotenv" {
-		keys := make([]string, 0, len(s.data))
-		for k := range s.data {
-			keys = append(keys, k)
-		}
-
-		return keys, nil
-	}
-
-	return nil, fmt.Errorf("unsupported file type: %s", s.fileType)
+	return s.doc.Keys(), nil
 }
 
 func (s *SopsCliSecretVault) BatchGetSecretValues(keys []string, params *vaults.GetSecretValueParams) (map[string]string, error) {
-	values := map[string]string{}
-	for _, key := range keys {
-		v, err := s.GetSecretValue(key, params)
-		if err != nil {
-			return nil, err
-		}
-
-		values[key] = v
-	}
-
-	return values, nil
+	return batchGetSecretValues(s, keys, params)
 }
 
 func (s *SopsCliSecretVault) MapSecretValues(query map[string]string, params *vaults.GetSecretValueParams) (map[string]string, error) {
-	keys := make([]string, 0, len(query))
-	for k := range query {
-		keys = append(keys, k)
-	}
-
-	res, err := s.BatchGetSecretValues(keys, params)
-	if err != nil {
-		return nil, err
-	}
-
-	values := map[string]string{}
-	for k, v := range query {
-		if val, ok := res[k]; ok {
-			values[v] = val
-		}
-	}
-
-	return values, nil
+	return mapSecretValues(s, query, params)
 }
 
 func (s *SopsCliSecretVault) SetSecretValue(key, value string, params *vaults.SetSecretValueParams) error {
@@ -164,13 +136,7 @@ func (s *SopsCliSecretVault) setSecretValue(key, value string) error {
 		}
 	}
 
-	if s.fileType == "dotenv" {
-		key = normalizeKey(key, s.fileType)
-		s.data[key] = value
-		return nil
-	} else {
-		return fmt.Errorf("unsupported file type: %s", s.fileType)
-	}
+	return s.doc.Set(normalizeKey(key, s.fileType), value)
 }
 
 func (s *SopsCliSecretVault) BatchSetSecretValues(values map[string]string, params *vaults.SetSecretValueParams) error {
@@ -196,42 +162,20 @@ func (s *SopsCliSecretVault) DeleteSecret(key string, params *vaults.DeleteSecre
 		}
 	}
 
-	if s.fileType == "dotenv" {
-		key = normalizeKey(key, s.fileType)
-		if _, ok := s.data[key]; ok {
-			delete(s.data, key)
-			err := s.Encrypt()
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		return fmt.Errorf("unsupported file type: %s", s.fileType)
+	if s.doc.Delete(normalizeKey(key, s.fileType)) {
+		return s.Encrypt()
 	}
 
 	return nil
 }
 
 func (s *SopsCliSecretVault) Decrypt() error {
-
-	vars := map[string]string{}
-
-	if s.fileType != "dotenv" {
-		return fmt.Errorf("unsupported file type: %s", s.fileType)
-	}
-
-	switch s.params.Driver {
-	case "age":
-		if s.params.Age != nil {
-			if s.params.Age.KeyFile != "" {
-				vars["SOPS_AGE_KEY_FILE"] = s.params.Age.KeyFile
-			} else if s.params.Age.Key != "" {
-				vars["SOPS_AGE_KEY"] = s.params.Age.Key
-			}
-		}
+	vars, err := s.driverEnv()
+	if err != nil {
+		return err
 	}
 
-	args := []string{"decrypt"}
+	args := []string{"decrypt", "--input-type", s.fileType, "--output-type", s.fileType}
 
 	if s.params.ConfigFile != "" {
 		args = append(args, "--config", s.params.ConfigFile)
@@ -240,7 +184,7 @@ func (s *SopsCliSecretVault) Decrypt() error {
 	args = append(args, s.params.File)
 
 	cmd := xexec.New("sops", args...)
-	cmd.WithEnvMap(vars)
+	cmd.WithEnv(sopsEnv(vars)...)
 	cmd.WithCwd(filepath.Dir(s.params.File))
 
 	out, err := cmd.Output()
@@ -248,132 +192,238 @@ func (s *SopsCliSecretVault) Decrypt() error {
 		return fmt.Errorf("error decrypting file: %s", out.ErrorText())
 	}
 
-	data := out.Stdout
-
-	kv, err := godotenv.UnmarshalBytes(data)
+	doc, err := parseDocument(s.fileType, out.Stdout)
 	if err != nil {
-		return err
-	}
-
-	s.data = map[string]interface{}{}
-	for k, v := range kv {
-		s.data[k] = v
+		return fmt.Errorf("error parsing %s file %s: %w", s.fileType, s.params.File, err)
 	}
 
+	s.doc = doc
+	s.loaded = true
 	return nil
 }
 
 func (s *SopsCliSecretVault) Encrypt() error {
 
-	if s.fileType != "dotenv" {
-		return fmt.Errorf("unsupported file type: %s", s.fileType)
+	if s.doc == nil {
+		doc, err := newDocument(s.fileType)
+		if err != nil {
+			return err
+		}
+
+		s.doc = doc
 	}
 
-	vars := map[string]string{}
-	args := []string{"-e"}
+	vars, err := s.driverEnv()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-e", "--input-type", s.fileType, "--output-type", s.fileType}
 
 	if s.params.ConfigFile != "" {
 		args = append(args, "--config", s.params.ConfigFile)
 	}
 
-	switch s.params.Driver {
+	args = append(args, s.driverArgs()...)
+
+	bits, err := s.doc.Marshal(s.params.Indent)
+	if err != nil {
+		return err
+	}
+
+	// the plaintext is only written to a private temp directory and sops
+	// writes the encrypted file to stdout, so the file is replaced only
+	// once encryption succeeds.
+	tmpDir, err := os.MkdirTemp("", "j9d-sops-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	plain := filepath.Join(tmpDir, "plain"+filepath.Ext(s.params.File))
+	err = os.WriteFile(plain, bits, 0600)
+	if err != nil {
+		return err
+	}
+
+	// the filename override keeps the creation rules of the .sops.yaml
+	// file matching the vault file.
+	args = append(args, "--filename-override", s.params.File, plain)
+
+	dir := filepath.Dir(s.params.File)
+	for k := range vars {
+		logs.Tracef("sops env %s", k)
+	}
+
+	cmd := xexec.New("sops", args...)
+	cmd.WithCwd(dir)
+	cmd.WithEnv(sopsEnv(vars)...)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("error encrypting file: %s %s", err.Error(), out.ErrorText())
+	}
+
+	if len(out.Stdout) == 0 {
+		return fmt.Errorf("error encrypting file: sops returned no output")
+	}
+
+	return writeFile(s.params.File, out.Stdout)
+}
+
+// DriverName returns the sops key driver of an alias e.g. kms for aws.
+func DriverName(driver string) (string, error) {
+	switch strings.ToLower(driver) {
+	case "", "age":
+		return "age", nil
+	case "aws", "aws-kms", "kms":
+		return "kms", nil
+	case "gcp", "gcp-kms":
+		return "gcp-kms", nil
+	case "azure", "azkv", "azure-kv":
+		return "azure-kv", nil
+	case "vault", "hc-vault", "hc-vault-transit":
+		return "hc-vault-transit", nil
+	case "pgp", "gpg":
+		return "pgp", nil
+	}
+
+	return "", fmt.Errorf("unsupported sops driver %s", driver)
+}
+
+// driverArgs returns the sops flags of the keys to encrypt new files
+// with. Without keys, sops uses the creation rules of .sops.yaml.
+func (s *SopsCliSecretVault) driverArgs() []string {
+	p := s.params
+	args := []string{}
+	switch p.Driver {
 	case "age":
-		if s.params.Age != nil {
-			if len(s.params.Age.Recipients) > 0 {
-				args = append(args, "--age", s.params.Age.Recipients)
-			}
+		if p.Age != nil && p.Age.Recipients != "" {
+			args = append(args, "--age", p.Age.Recipients)
+		}
 
-			if s.params.Age.KeyFile != "" {
-				vars["SOPS_AGE_KEY_FILE"] = s.params.Age.KeyFile
-			} else if s.params.Age.Key != "" {
-				vars["SOPS_AGE_KEY"] = s.params.Age.Key
-			}
+	case "kms":
+		arns := p.KmsArns
+		if p.Kms != nil && p.Kms.Uri != "" {
+			arns = p.Kms.Uri
 		}
 
-	case "azure":
-	case "azkv":
-	case "azure-kv":
-		if s.params.AzureKvUri != "" {
-			args = append(args, "--azure-kv", s.params.AzureKvUri)
+		if arns != "" {
+			args = append(args, "--kms", arns)
 		}
-	case "vault":
-	case "hc-vault-transit":
-		if s.params.VaultUri != "" {
-			args = append(args, "--hc-vault-transit", s.params.VaultUri)
+
+		if p.Kms != nil && p.Kms.AwsProfile != "" {
+			args = append(args, "--aws-profile", p.Kms.AwsProfile)
+		}
+
+		if p.Kms != nil && p.Kms.EncryptionContext != "" {
+			args = append(args, "--encryption-context", p.Kms.EncryptionContext)
 		}
 
-	case "gcp":
 	case "gcp-kms":
-		if s.params.GcpKmsUri != "" {
-			args = append(args, "--gcp-kms", s.params.GcpKmsUri)
+		if p.GcpKmsUri != "" {
+			args = append(args, "--gcp-kms", p.GcpKmsUri)
 		}
 
-	case "aws":
-	case "aws-kms":
-	case "kms":
-		if s.params.KmsArns != "" {
-			args = append(args, "--kms", s.params.KmsArns)
+	case "azure-kv":
+		if p.AzureKvUri != "" {
+			args = append(args, "--azure-kv", p.AzureKvUri)
+		}
+
+	case "hc-vault-transit":
+		if p.VaultUri != "" {
+			args = append(args, "--hc-vault-transit", p.VaultUri)
 		}
 
 	case "pgp":
-		if s.params.PgpFingerprints != "" {
-			args = append(args, "--pgp", s.params.PgpFingerprints)
+		if p.PgpFingerprints != "" {
+			args = append(args, "--pgp", p.PgpFingerprints)
 		}
 	}
 
-	args = append(args, "-i")
-	args = append(args, s.params.File)
+	return args
+}
 
-	kv := map[string]string{}
-	for k, v := range s.data {
-		kv[k] = v.(string)
+// driverEnv returns the variables sops needs to use the keys of the
+// driver. Credentials of the cloud drivers e.g. VAULT_TOKEN are read
+// from the environment.
+func (s *SopsCliSecretVault) driverEnv() (map[string]string, error) {
+	if s.driverErr != nil {
+		return nil, s.driverErr
 	}
 
-	str, err := godotenv.Marshal(kv)
-	if err != nil {
-		return err
-	}
+	vars := map[string]string{}
+	switch s.params.Driver {
+	case "age":
+		if s.params.Age != nil {
+			if s.params.Age.KeyFile != "" {
+				vars["SOPS_AGE_KEY_FILE"] = s.params.Age.KeyFile
+			} else if s.params.Age.Key != "" {
+				vars["SOPS_AGE_KEY"] = s.params.Age.Key
+			}
+		}
 
-	bits := []byte(str)
-	fi, err := os.Stat(s.params.File)
-	var mode os.FileMode
-	mode = 0644
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
+	case "kms":
+		if s.params.Kms != nil && s.params.Kms.AwsProfile != "" {
+			vars["AWS_PROFILE"] = s.params.Kms.AwsProfile
 		}
-	} else {
-		mode = fi.Mode()
 	}
 
-	if xfs.Exists(s.params.File) {
-		err = os.Remove(s.params.File)
-	}
+	return vars, nil
+}
 
-	// TODO: check if directory exists
-	if err = os.WriteFile(s.params.File, bits, mode); err != nil {
-		return err
+// sopsEnv returns the environment of the process with the variables.
+func sopsEnv(vars map[string]string) []string {
+	env := []string{}
+	for _, e := range os.Environ() {
+		k, _, _ := strings.Cut(e, "=")
+		if _, ok := vars[k]; !ok {
+			env = append(env, e)
+		}
 	}
 
-	if !xfs.Exists(s.params.File) {
-		return fmt.Errorf("file not found: %s", s.params.File)
+	for k, v := range vars {
+		env = append(env, k+"="+v)
 	}
 
-	dir := filepath.Dir(s.params.File)
-	for k, v := range vars {
-		println(k, v)
+	return env
+}
+
+func batchGetSecretValues(v vaults.SecretVault, keys []string, params *vaults.GetSecretValueParams) (map[string]string, error) {
+	values := map[string]string{}
+	for _, key := range keys {
+		value, err := v.GetSecretValue(key, params)
+		if err != nil {
+			return nil, err
+		}
+
+		values[key] = value
 	}
 
-	cmd := xexec.New("sops", args...)
-	cmd.WithCwd(dir)
-	cmd.WithEnvMap(vars)
+	return values, nil
+}
 
-	out, err := cmd.Output()
+// mapSecretValues returns the values of the query keys by the names
+// they map to.
+func mapSecretValues(v vaults.SecretVault, query map[string]string, params *vaults.GetSecretValueParams) (map[string]string, error) {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+
+	res, err := v.BatchGetSecretValues(keys, params)
 	if err != nil {
-		return fmt.Errorf("error encrypting file: %s %s %s", err.Error(), out.Text(), out.ErrorText())
+		return nil, err
 	}
 
-	return nil
+	values := map[string]string{}
+	for k, name := range query {
+		if val, ok := res[k]; ok {
+			values[name] = val
+		}
+	}
+
+	return values, nil
 }
 
 func normalizeKey(key string, filetype string) string {
@@ -394,9 +444,11 @@ func normalizeKey(key string, filetype string) string {
 		return sb.String()
 	}
 
+	// nested keys e.g. db/password are paths separated by dots, other
+	// characters are part of the key names e.g. db_password.
 	sb := strings.Builder{}
 	for _, c := range key {
-		if c == '_' || c == '-' || c == '.' || c == '/' || c == ':' {
+		if c == '.' || c == '/' || c == ':' {
 			sb.WriteRune('.')
 			continue
 		}
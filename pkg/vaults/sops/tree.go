@@ -0,0 +1,396 @@
+package sops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// treeDocument is a yaml or json file. The yaml nodes are kept so that
+// writes keep the structure, key order and comments of the file.
+type treeDocument struct {
+	root *yaml.Node
+	json bool
+}
+
+func newTreeDocument(json bool) *treeDocument {
+	return &treeDocument{
+		root: &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+		json: json,
+	}
+}
+
+func parseTreeDocument(data []byte, json bool) (*treeDocument, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(doc.Content) == 0 {
+		return newTreeDocument(json), nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("sops document root must be a mapping")
+	}
+
+	return &treeDocument{root: root, json: json}, nil
+}
+
+// splitKey splits a key into the path of a nested value e.g.
+// db.password or db/password.
+func splitKey(key string) []string {
+	return strings.FieldsFunc(key, func(r rune) bool {
+		return r == '.' || r == '/' || r == ':'
+	})
+}
+
+func (d *treeDocument) Get(key string) (string, error) {
+	n := d.lookup(key)
+	if n == nil {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+
+	if n.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("key %s is not a value", key)
+	}
+
+	if n.Tag == "!!null" {
+		return "", nil
+	}
+
+	return n.Value, nil
+}
+
+func (d *treeDocument) Set(key, value string) error {
+	if n := mapValue(d.root, key); n != nil {
+		return setScalar(n, key, value)
+	}
+
+	parts := splitKey(key)
+	if len(parts) == 0 {
+		return fmt.Errorf("invalid key: %s", key)
+	}
+
+	node := d.root
+	for _, part := range parts[:len(parts)-1] {
+		next := child(node, part)
+		if next == nil {
+			if node.Kind != yaml.MappingNode {
+				return fmt.Errorf("key %s is not a mapping", key)
+			}
+
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			appendPair(node, part, next)
+		}
+
+		node = next
+	}
+
+	last := parts[len(parts)-1]
+	if n := child(node, last); n != nil {
+		return setScalar(n, key, value)
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("key %s is not a mapping", key)
+	}
+
+	appendPair(node, last, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	return nil
+}
+
+func (d *treeDocument) Delete(key string) bool {
+	if removePair(d.root, key) {
+		return true
+	}
+
+	parts := splitKey(key)
+	if len(parts) == 0 {
+		return false
+	}
+
+	node := d.root
+	for _, part := range parts[:len(parts)-1] {
+		node = child(node, part)
+		if node == nil {
+			return false
+		}
+	}
+
+	last := parts[len(parts)-1]
+	if node.Kind == yaml.SequenceNode {
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i >= len(node.Content) {
+			return false
+		}
+
+		node.Content = append(node.Content[:i], node.Content[i+1:]...)
+		return true
+	}
+
+	return removePair(node, last)
+}
+
+// Keys returns the dotted paths of the values in document order.
+func (d *treeDocument) Keys() []string {
+	keys := []string{}
+	var walk func(prefix string, n *yaml.Node)
+	walk = func(prefix string, n *yaml.Node) {
+		n = resolve(n)
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				walk(joinKey(prefix, n.Content[i].Value), n.Content[i+1])
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				walk(joinKey(prefix, strconv.Itoa(i)), c)
+			}
+		case yaml.ScalarNode:
+			keys = append(keys, prefix)
+		}
+	}
+
+	walk("", d.root)
+	return keys
+}
+
+func (d *treeDocument) Marshal(indent int) ([]byte, error) {
+	if indent < 1 {
+		indent = 2
+	}
+
+	if d.json {
+		b := &bytes.Buffer{}
+		err := writeJson(b, d.root, strings.Repeat(" ", indent), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		b.WriteString("\n")
+		return b.Bytes(), nil
+	}
+
+	b := &bytes.Buffer{}
+	enc := yaml.NewEncoder(b)
+	enc.SetIndent(indent)
+	err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{d.root}})
+	if err != nil {
+		return nil, err
+	}
+
+	err = enc.Close()
+	return b.Bytes(), err
+}
+
+// lookup returns the node of the key or nil. A top level key with
+// dots is found before the nested path.
+func (d *treeDocument) lookup(key string) *yaml.Node {
+	if n := mapValue(d.root, key); n != nil {
+		return n
+	}
+
+	node := d.root
+	for _, part := range splitKey(key) {
+		node = child(node, part)
+		if node == nil {
+			return nil
+		}
+	}
+
+	if node == d.root {
+		return nil
+	}
+
+	return node
+}
+
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	return n
+}
+
+// child returns the value of the key in a mapping or the item of the
+// index in a sequence.
+func child(n *yaml.Node, key string) *yaml.Node {
+	n = resolve(n)
+	switch n.Kind {
+	case yaml.MappingNode:
+		return mapValue(n, key)
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(n.Content) {
+			return nil
+		}
+
+		return resolve(n.Content[i])
+	}
+
+	return nil
+}
+
+func mapValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return resolve(n.Content[i+1])
+		}
+	}
+
+	return nil
+}
+
+func appendPair(n *yaml.Node, key string, value *yaml.Node) {
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func removePair(n *yaml.Node, key string) bool {
+	n = resolve(n)
+	if n.Kind != yaml.MappingNode {
+		return false
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// setScalar sets the value of a scalar node. The tag of the node is
+// kept when the value still has that type e.g. a port, otherwise the
+// value is written as a string.
+func setScalar(n *yaml.Node, key, value string) error {
+	if n.Kind != yaml.ScalarNode {
+		return fmt.Errorf("key %s is not a value", key)
+	}
+
+	if n.Tag != scalarTag(value) {
+		n.Tag = "!!str"
+	}
+
+	n.Value = value
+	return nil
+}
+
+func scalarTag(value string) string {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(value), &doc)
+	if err != nil || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.ScalarNode {
+		return "!!str"
+	}
+
+	return doc.Content[0].Tag
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+// writeJson writes the node as indented json in the order of the
+// yaml node.
+func writeJson(b *bytes.Buffer, n *yaml.Node, indent string, depth int) error {
+	n = resolve(n)
+	pad := strings.Repeat(indent, depth+1)
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Content) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+
+		b.WriteString("{\n")
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			b.WriteString(pad)
+			writeJsonString(b, n.Content[i].Value)
+			b.WriteString(": ")
+			err := writeJson(b, n.Content[i+1], indent, depth+1)
+			if err != nil {
+				return err
+			}
+
+			if i+2 < len(n.Content) {
+				b.WriteString(",")
+			}
+
+			b.WriteString("\n")
+		}
+
+		b.WriteString(strings.Repeat(indent, depth))
+		b.WriteString("}")
+
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+
+		b.WriteString("[\n")
+		for i, c := range n.Content {
+			b.WriteString(pad)
+			err := writeJson(b, c, indent, depth+1)
+			if err != nil {
+				return err
+			}
+
+			if i+1 < len(n.Content) {
+				b.WriteString(",")
+			}
+
+			b.WriteString("\n")
+		}
+
+		b.WriteString(strings.Repeat(indent, depth))
+		b.WriteString("]")
+
+	case yaml.ScalarNode:
+		switch n.Tag {
+		case "!!null":
+			b.WriteString("null")
+		case "!!bool":
+			b.WriteString(strings.ToLower(n.Value))
+		case "!!int", "!!float":
+			if json.Valid([]byte(n.Value)) {
+				b.WriteString(n.Value)
+			} else {
+				writeJsonString(b, n.Value)
+			}
+		default:
+			writeJsonString(b, n.Value)
+		}
+
+	default:
+		return fmt.Errorf("unsupported yaml node kind %d", n.Kind)
+	}
+
+	return nil
+}
+
+func writeJsonString(b *bytes.Buffer, s string) {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+
+	// Encode ends the value with a newline.
+	b.Truncate(b.Len() - 1)
+}
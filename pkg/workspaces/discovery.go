@@ -0,0 +1,215 @@
+package workspaces
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/types"
+)
+
+type DiscoverOptions struct {
+	// Save persists the discovered projects to the workspace file.
+	Save bool
+}
+
+// Discover walks the workspace directory using the include and exclude
+// globs of the workspace discovery block and registers every directory
+// containing a j9d.yaml or <target>.j9d.yaml file as a project. The
+// project name is the name of the directory.
+//
+// Projects and targets already declared in the workspace file take
+// priority over discovered ones.
+func Discover(wsf *types.WorkspaceFile, options *DiscoverOptions) (map[string]types.Project, error) {
+	if wsf == nil || wsf.Config == nil {
+		return nil, fmt.Errorf("workspace not loaded")
+	}
+
+	if options == nil {
+		options = &DiscoverOptions{}
+	}
+
+	found, err := discover(Dir(wsf), wsf.Config.Discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	if wsf.Config.Projects == nil {
+		wsf.Config.Projects = make(map[string]types.Project)
+	}
+
+	for name, p := range found {
+		existing, ok := wsf.Config.Projects[name]
+		if !ok || existing.Targets == nil {
+			wsf.Config.Projects[name] = p
+			continue
+		}
+
+		for target, file := range p.Targets {
+			if _, ok := existing.Targets[target]; !ok {
+				existing.Targets[target] = file
+			}
+		}
+	}
+
+	if options.Save {
+		err = wsf.Save()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+func discover(root string, discovery *types.Discovery) (map[string]types.Project, error) {
+	projects := make(map[string]types.Project)
+	dirs := make(map[string]string)
+
+	if discovery == nil {
+		return projects, nil
+	}
+
+	include := discovery.Include
+	if len(include) == 0 {
+		include = []string{"**"}
+	}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+
+			if strings.HasPrefix(d.Name(), ".") || matchAny(discovery.Exclude, rel) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		target, ok := targetName(d.Name())
+		if !ok {
+			return nil
+		}
+
+		dir := path.Dir(rel)
+		if dir == "." {
+			return nil
+		}
+
+		if matchAny(discovery.Exclude, rel) {
+			return nil
+		}
+
+		if !matchAny(include, dir) && !matchAny(include, rel) {
+			return nil
+		}
+
+		name := path.Base(dir)
+		if other, ok := dirs[name]; ok && other != dir {
+			return fmt.Errorf("project %s found in both %s and %s", name, other, dir)
+		}
+
+		dirs[name] = dir
+
+		project, ok := projects[name]
+		if !ok {
+			project = types.Project{Targets: make(map[string]string)}
+			projects[name] = project
+		}
+
+		project.Targets[target] = "./" + rel
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return projects, nil
+}
+
+// targetName returns the target for a j9d file name
+// e.g. j9d.yaml -> default, prod.j9d.yaml -> prod
+func targetName(name string) (string, bool) {
+	if name == "j9d.yaml" || name == "j9d.yml" {
+		return DefaultTarget, true
+	}
+
+	for _, ext := range []string{".j9d.yaml", ".j9d.yml"} {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+
+	return "", false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchGlob matches a slash separated path against a glob pattern. In
+// addition to the filepath.Match syntax, ** matches zero or more
+// directories.
+func matchGlob(pattern, name string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+
+		ok, err := path.Match(pattern[0], parts[0])
+		if err != nil || !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+
+	return len(parts) == 0
+}
@@ -0,0 +1,83 @@
+package workspaces_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/workspaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"apps/traefik/j9d.yaml",
+		"apps/traefik/prod.j9d.yaml",
+		"apps/whoami/j9d.yaml",
+		"apps/legacy/j9d.yaml",
+		"other/skipped/j9d.yaml",
+		"apps/.hidden/j9d.yaml",
+	}
+
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte("name: test"), 0644))
+	}
+
+	content := `name: org
+projects:
+  whoami:
+    default: ./custom/j9d.yaml
+discovery:
+  include:
+    - apps/*
+  exclude:
+    - apps/legacy
+`
+	wsFile := filepath.Join(dir, "j9d-workspace.yaml")
+	assert.NoError(t, os.WriteFile(wsFile, []byte(content), 0644))
+
+	wsf, err := workspaces.LoadFile(dir)
+	assert.NoError(t, err)
+
+	found, err := workspaces.Discover(wsf, &workspaces.DiscoverOptions{Save: true})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Contains(t, found, "traefik")
+	assert.Contains(t, found, "whoami")
+
+	traefik := wsf.Config.Projects["traefik"]
+	assert.Equal(t, "./apps/traefik/j9d.yaml", traefik.Targets["default"])
+	assert.Equal(t, "./apps/traefik/prod.j9d.yaml", traefik.Targets["prod"])
+
+	// declared targets take priority
+	assert.Equal(t, "./custom/j9d.yaml", wsf.Config.Projects["whoami"].Targets["default"])
+
+	reloaded, err := workspaces.LoadFile(wsFile)
+	assert.NoError(t, err)
+	assert.Len(t, reloaded.Config.Projects, 2)
+	assert.Equal(t, "./apps/traefik/prod.j9d.yaml", reloaded.Config.Projects["traefik"].Targets["prod"])
+}
+
+func TestResolveFileDiscoversProjects(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "stacks", "redis", "j9d.yaml")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	assert.NoError(t, os.WriteFile(p, []byte("name: redis"), 0644))
+
+	content := `name: org
+discovery:
+  include:
+    - "**"
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "j9d-workspace.yaml"), []byte(content), 0644))
+
+	wsf, err := workspaces.LoadFile(dir)
+	assert.NoError(t, err)
+
+	file, err := workspaces.ResolveFile(wsf, "redis", "")
+	assert.NoError(t, err)
+	assert.Equal(t, p, file)
+}
@@ -0,0 +1,374 @@
+package workspaces
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jolt9dev/j9d/pkg/consts"
+	"github.com/jolt9dev/j9d/pkg/types"
+	fs "github.com/jolt9dev/j9d/pkg/xfs"
+)
+
+const (
+	DefaultWorkspace = "default"
+	DefaultTarget    = "default"
+)
+
+// ProjectRef is a reference to a project within a workspace
+// e.g. @org/traefik -> { Workspace: "org", Project: "traefik" }
+type ProjectRef struct {
+	Workspace string
+	Project   string
+}
+
+func (r ProjectRef) String() string {
+	return fmt.Sprintf("@%s/%s", r.Workspace, r.Project)
+}
+
+// ParseProjectRef parses a project in the @workspace/project format. When
+// the workspace scope is omitted, the default workspace is used.
+func ParseProjectRef(project string) (*ProjectRef, error) {
+	project = strings.TrimSpace(project)
+	if project == "" {
+		return nil, fmt.Errorf("project is empty")
+	}
+
+	if !strings.Contains(project, "/") {
+		if strings.HasPrefix(project, "@") {
+			return nil, fmt.Errorf("invalid project %s, expected @workspace/project", project)
+		}
+
+		return &ProjectRef{Workspace: DefaultWorkspace, Project: project}, nil
+	}
+
+	parts := strings.SplitN(project, "/", 2)
+	ws := NormalizeName(parts[0])
+	name := parts[1]
+
+	if ws == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid project %s, expected @workspace/project", project)
+	}
+
+	return &ProjectRef{Workspace: ws, Project: name}, nil
+}
+
+// NormalizeName removes the leading @ from a workspace name.
+func NormalizeName(name string) string {
+	return strings.TrimPrefix(strings.TrimSpace(name), "@")
+}
+
+// FindPath returns the workspace file registered in the global config
+// for the given workspace name. Names are matched with or without the
+// leading @.
+func FindPath(cfg *types.GlobalConfig, name string) (string, bool) {
+	if cfg == nil || cfg.Workspaces == nil {
+		return "", false
+	}
+
+	name = NormalizeName(name)
+	for _, key := range []string{name, "@" + name} {
+		if p, ok := cfg.Workspaces[key]; ok && p != "" {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
+// Load loads the workspace file for the named workspace using the
+// global config.
+func Load(name string) (*types.WorkspaceFile, error) {
+	cfg, err := types.GetGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadFromConfig(cfg, name)
+}
+
+// LoadFromConfig loads the workspace file for the named workspace using
+// the provided global config.
+func LoadFromConfig(cfg *types.GlobalConfig, name string) (*types.WorkspaceFile, error) {
+	p, ok := FindPath(cfg, name)
+	if !ok {
+		return nil, fmt.Errorf("workspace @%s not found", NormalizeName(name))
+	}
+
+	return LoadFile(p)
+}
+
+// LoadFile loads a workspace file. When path is a directory, the
+// j9d-workspace.yaml file within the directory is used.
+func LoadFile(path string) (*types.WorkspaceFile, error) {
+	file, err := resolveWorkspaceFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fs.Exists(file) {
+		// the default workspace is created when it is first saved.
+		if def, err := types.DefaultWorkspaceFile(); err == nil && file == def {
+			return types.NewDefaultWorkspaceFile(file), nil
+		}
+
+		return nil, fmt.Errorf("workspace file %s not found", file)
+	}
+
+	wsf := &types.WorkspaceFile{File: file}
+	err = wsf.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if wsf.Config.Projects == nil {
+		wsf.Config.Projects = make(map[string]types.Project)
+	}
+
+	return wsf, nil
+}
+
+// Dir returns the root directory of the workspace.
+func Dir(wsf *types.WorkspaceFile) string {
+	return filepath.Dir(wsf.File)
+}
+
+// ResolveFile maps a project and target in the workspace to a concrete
+// j9d file. Target paths are relative to the workspace directory and may
+// point to a directory containing a j9d.yaml file. Targets that are not
+// registered resolve to the <target>.j9d.yaml file of the default target.
+func ResolveFile(wsf *types.WorkspaceFile, project, target string) (string, error) {
+	if wsf == nil || wsf.Config == nil {
+		return "", fmt.Errorf("workspace not loaded")
+	}
+
+	if target == "" {
+		target = DefaultTarget
+	}
+
+	p, ok := wsf.Config.Projects[project]
+	if !ok && wsf.Config.Discovery != nil {
+		// the project may not be registered yet, so try to
+		// discover it without persisting the workspace file.
+		_, err := Discover(wsf, nil)
+		if err != nil {
+			return "", err
+		}
+
+		p, ok = wsf.Config.Projects[project]
+	}
+
+	if !ok {
+		return "", fmt.Errorf("project %s not found in workspace %s", project, wsf.Config.Name)
+	}
+
+	rel, ok := p.Targets[target]
+	if (!ok || rel == "") && target != DefaultTarget {
+		// targets that are not registered fall back to the
+		// <target>.j9d.yaml file next to the default target.
+		base, err := ResolveFile(wsf, project, DefaultTarget)
+		if err == nil {
+			if file, ok := types.FindTargetFile(filepath.Dir(base), target); ok {
+				return file, nil
+			}
+		}
+	}
+
+	if !ok || rel == "" {
+		return "", fmt.Errorf("target %s not found for project %s in workspace %s", target, project, wsf.Config.Name)
+	}
+
+	file, err := fs.Resolve(rel, Dir(wsf))
+	if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("j9d file %s not found for project %s", file, project)
+		}
+
+		return "", err
+	}
+
+	if fi.IsDir() {
+		var ok bool
+		file, ok = types.FindTargetFile(file, DefaultTarget)
+		if !ok {
+			return "", fmt.Errorf("j9d file %s not found for project %s", file, project)
+		}
+	}
+
+	return file, nil
+}
+
+func resolveWorkspaceFile(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("workspace path is empty")
+	}
+
+	if !filepath.IsAbs(path) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+
+		path = abs
+	}
+
+	fi, err := os.Stat(path)
+	if err == nil && fi.IsDir() {
+		return filepath.Join(path, consts.WorkspaceFileName), nil
+	}
+
+	return path, nil
+}
+
+// Init creates a new workspace file in dir. An error is returned when
+// the workspace file already exists.
+func Init(dir, name string) (*types.WorkspaceFile, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = filepath.Base(dir)
+	}
+
+	file := filepath.Join(dir, consts.WorkspaceFileName)
+	if fs.Exists(file) {
+		return nil, fmt.Errorf("workspace file %s already exists", file)
+	}
+
+	err = fs.EnsureDir(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	wsf := &types.WorkspaceFile{
+		File: file,
+		Config: &types.Workspace{
+			Name:     NormalizeName(name),
+			Projects: make(map[string]types.Project),
+			Discovery: &types.Discovery{
+				Include: []string{"**"},
+				Exclude: []string{},
+			},
+		},
+	}
+
+	err = wsf.Save()
+	if err != nil {
+		return nil, err
+	}
+
+	return wsf, nil
+}
+
+// Register adds the workspace file to the global config under name.
+func Register(cfg *types.GlobalConfig, name, file string) error {
+	name = NormalizeName(name)
+	if name == "" {
+		return fmt.Errorf("workspace name is empty")
+	}
+
+	if cfg.Workspaces == nil {
+		cfg.Workspaces = make(map[string]string)
+	}
+
+	delete(cfg.Workspaces, "@"+name)
+	cfg.Workspaces[name] = file
+	return nil
+}
+
+// Unregister removes the workspace from the global config.
+func Unregister(cfg *types.GlobalConfig, name string) bool {
+	name = NormalizeName(name)
+	found := false
+	for _, key := range []string{name, "@" + name} {
+		if _, ok := cfg.Workspaces[key]; ok {
+			delete(cfg.Workspaces, key)
+			found = true
+		}
+	}
+
+	return found
+}
+
+// AddProject adds or replaces a project target in the workspace. The
+// file must exist and is stored relative to the workspace directory
+// when it resides within it.
+func AddProject(wsf *types.WorkspaceFile, project, target, file string) error {
+	if project == "" || strings.ContainsAny(project, "/@") {
+		return fmt.Errorf("invalid project name %s", project)
+	}
+
+	if target == "" {
+		target = DefaultTarget
+	}
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("j9d file %s not found", abs)
+		}
+
+		return err
+	}
+
+	if fi.IsDir() && !fs.Exists(filepath.Join(abs, "j9d.yaml")) {
+		return fmt.Errorf("j9d file %s not found", filepath.Join(abs, "j9d.yaml"))
+	}
+
+	value := abs
+	rel, err := filepath.Rel(Dir(wsf), abs)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		value = "./" + filepath.ToSlash(rel)
+	}
+
+	if wsf.Config.Projects == nil {
+		wsf.Config.Projects = make(map[string]types.Project)
+	}
+
+	p, ok := wsf.Config.Projects[project]
+	if !ok || p.Targets == nil {
+		p = types.Project{Targets: make(map[string]string)}
+	}
+
+	p.Targets[target] = value
+	wsf.Config.Projects[project] = p
+	return nil
+}
+
+// RemoveProject removes a project from the workspace. When target is
+// not empty, only that target is removed.
+func RemoveProject(wsf *types.WorkspaceFile, project, target string) error {
+	p, ok := wsf.Config.Projects[project]
+	if !ok {
+		return fmt.Errorf("project %s not found in workspace %s", project, wsf.Config.Name)
+	}
+
+	if target == "" {
+		delete(wsf.Config.Projects, project)
+		return nil
+	}
+
+	if _, ok := p.Targets[target]; !ok {
+		return fmt.Errorf("target %s not found for project %s in workspace %s", target, project, wsf.Config.Name)
+	}
+
+	delete(p.Targets, target)
+	if len(p.Targets) == 0 {
+		delete(wsf.Config.Projects, project)
+	}
+
+	return nil
+}
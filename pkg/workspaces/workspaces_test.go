@@ -0,0 +1,134 @@
+package workspaces_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jolt9dev/j9d/pkg/types"
+	"github.com/jolt9dev/j9d/pkg/workspaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProjectRef(t *testing.T) {
+	ref, err := workspaces.ParseProjectRef("@org/traefik")
+	assert.NoError(t, err)
+	assert.Equal(t, "org", ref.Workspace)
+	assert.Equal(t, "traefik", ref.Project)
+
+	ref, err = workspaces.ParseProjectRef("traefik")
+	assert.NoError(t, err)
+	assert.Equal(t, "default", ref.Workspace)
+	assert.Equal(t, "traefik", ref.Project)
+
+	_, err = workspaces.ParseProjectRef("@org")
+	assert.Error(t, err)
+
+	_, err = workspaces.ParseProjectRef("@org/a/b")
+	assert.Error(t, err)
+}
+
+func TestResolveFile(t *testing.T) {
+	dir := t.TempDir()
+	wsFile := filepath.Join(dir, "j9d-workspace.yaml")
+	content := `name: org
+projects:
+  traefik: ./traefik
+  whoami:
+    default: ./whoami/j9d.yaml
+    prod: ./whoami/prod.j9d.yaml
+`
+	assert.NoError(t, os.WriteFile(wsFile, []byte(content), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "traefik"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "whoami"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "traefik", "j9d.yaml"), []byte("name: traefik"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "whoami", "j9d.yaml"), []byte("name: whoami"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "whoami", "prod.j9d.yaml"), []byte("name: whoami"), 0644))
+
+	cfg := &types.GlobalConfig{
+		Workspaces: map[string]string{
+			"@org": dir,
+		},
+	}
+
+	wsf, err := workspaces.LoadFromConfig(cfg, "org")
+	assert.NoError(t, err)
+	assert.Equal(t, wsFile, wsf.File)
+
+	file, err := workspaces.ResolveFile(wsf, "traefik", "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "traefik", "j9d.yaml"), file)
+
+	file, err = workspaces.ResolveFile(wsf, "whoami", "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "whoami", "prod.j9d.yaml"), file)
+
+	_, err = workspaces.ResolveFile(wsf, "whoami", "staging")
+	assert.Error(t, err)
+
+	_, err = workspaces.ResolveFile(wsf, "missing", "")
+	assert.Error(t, err)
+
+	_, err = workspaces.LoadFromConfig(cfg, "@missing")
+	assert.Error(t, err)
+}
+
+func TestInitAndAddProject(t *testing.T) {
+	dir := t.TempDir()
+	wsf, err := workspaces.Init(dir, "@org")
+	assert.NoError(t, err)
+	assert.Equal(t, "org", wsf.Config.Name)
+	assert.Equal(t, filepath.Join(dir, "j9d-workspace.yaml"), wsf.File)
+
+	_, err = workspaces.Init(dir, "org")
+	assert.Error(t, err)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "traefik"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "traefik", "j9d.yaml"), []byte("name: traefik"), 0644))
+
+	assert.NoError(t, workspaces.AddProject(wsf, "traefik", "", filepath.Join(dir, "traefik")))
+	assert.Equal(t, "./traefik", wsf.Config.Projects["traefik"].Targets["default"])
+
+	assert.Error(t, workspaces.AddProject(wsf, "whoami", "", filepath.Join(dir, "whoami")))
+	assert.Error(t, workspaces.AddProject(wsf, "@org/whoami", "", filepath.Join(dir, "traefik")))
+
+	assert.NoError(t, wsf.Save())
+	loaded, err := workspaces.LoadFile(dir)
+	assert.NoError(t, err)
+
+	file, err := workspaces.ResolveFile(loaded, "traefik", "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "traefik", "j9d.yaml"), file)
+
+	assert.Error(t, workspaces.RemoveProject(loaded, "traefik", "prod"))
+	assert.NoError(t, workspaces.RemoveProject(loaded, "traefik", ""))
+	assert.Error(t, workspaces.RemoveProject(loaded, "traefik", ""))
+
+	cfg := &types.GlobalConfig{Workspaces: map[string]string{"@org": "old"}}
+	assert.NoError(t, workspaces.Register(cfg, "org", wsf.File))
+	assert.Equal(t, map[string]string{"org": wsf.File}, cfg.Workspaces)
+	assert.True(t, workspaces.Unregister(cfg, "@org"))
+	assert.False(t, workspaces.Unregister(cfg, "org"))
+}
+
+func TestResolveFileTargetFallback(t *testing.T) {
+	dir := t.TempDir()
+	content := `name: org
+projects:
+  whoami: ./whoami
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "j9d-workspace.yaml"), []byte(content), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "whoami"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "whoami", "j9d.yaml"), []byte("name: whoami"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "whoami", "prod.j9d.yaml"), []byte("name: whoami"), 0644))
+
+	wsf, err := workspaces.LoadFile(dir)
+	assert.NoError(t, err)
+
+	file, err := workspaces.ResolveFile(wsf, "whoami", "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "whoami", "prod.j9d.yaml"), file)
+
+	_, err = workspaces.ResolveFile(wsf, "whoami", "staging")
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,6 +24,9 @@ type Cmd struct {
 	*exec.Cmd
 	logger        func(cmd *Cmd)
 	disableLogger bool
+	timeout       time.Duration
+	timer         *time.Timer
+	timedOut      atomic.Bool
 }
 
 func New(name string, args ...string) *Cmd {
@@ -30,10 +34,17 @@ func New(name string, args ...string) *Cmd {
 	return &Cmd{Cmd: cmd}
 }
 
-func SetLigger(f func(cmd *Cmd)) {
+// SetLogger sets the logger that is called for every command before
+// it is started.
+func SetLogger(f func(cmd *Cmd)) {
 	logger = f
 }
 
+// Deprecated: use SetLogger.
+func SetLigger(f func(cmd *Cmd)) {
+	SetLogger(f)
+}
+
 func (c *Cmd) SetLogger(f func(cmd *Cmd)) {
 	c.logger = f
 }
@@ -101,11 +112,17 @@ func (c *Cmd) WithEnv(env ...string) *Cmd {
 	return c
 }
 
+// WithTimeout kills the process when it runs longer than the timeout.
 func (c *Cmd) WithTimeout(timeout time.Duration) *Cmd {
-	c.Cmd.WaitDelay = timeout
+	c.timeout = timeout
 	return c
 }
 
+// TimedOut reports whether the process was killed by the timeout.
+func (c *Cmd) TimedOut() bool {
+	return c.timedOut.Load()
+}
+
 func (c *Cmd) WithCwd(dir string) *Cmd {
 	c.Cmd.Dir = dir
 	return c
@@ -242,31 +259,27 @@ func (c *Cmd) Output() (*PsOutput, error) {
 	}
 
 	err = c.Wait()
+	out.EndedAt = time.Now().UTC()
+	out.Stdout = outb.Bytes()
+	out.Stderr = errb.Bytes()
 	if err != nil {
-		out.EndedAt = time.Now().UTC()
 		out.Code = 1
 		return &out, err
 	}
 
-	out.EndedAt = time.Now().UTC()
 	out.Code = c.Cmd.ProcessState.ExitCode()
-	out.Stdout = outb.Bytes()
-	out.Stderr = errb.Bytes()
-
 	return &out, nil
 }
 
 func (c *Cmd) Start() error {
-	if c.disableLogger {
-		return c.Cmd.Start()
-	}
-
-	if c.logger != nil {
-		c.logger(c)
-	}
+	if !c.disableLogger {
+		if c.logger != nil {
+			c.logger(c)
+		}
 
-	if logger != nil {
-		logger(c)
+		if logger != nil {
+			logger(c)
+		}
 	}
 
 	p := c.Cmd.Path
@@ -277,9 +290,24 @@ func (c *Cmd) Start() error {
 		}
 	}
 
-	return c.Cmd.Start()
+	err := c.Cmd.Start()
+	if err != nil || c.timeout <= 0 {
+		return err
+	}
+
+	c.timer = time.AfterFunc(c.timeout, func() {
+		c.timedOut.Store(true)
+		c.Cmd.Process.Kill()
+	})
+
+	return nil
 }
 
 func (c *Cmd) Wait() error {
-	return c.Cmd.Wait()
+	err := c.Cmd.Wait()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	return err
 }
@@ -3,6 +3,7 @@ package xexec_test
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jolt9dev/j9d/pkg/xexec"
 	"github.com/stretchr/testify/assert"
@@ -47,3 +48,17 @@ func TestPipeCommand(t *testing.T) {
 	assert.Equal(t, 0, o.Code)
 	assert.Equal(t, "Hello World", strings.TrimSpace(o.Text()))
 }
+
+func TestTimeoutWithoutLogger(t *testing.T) {
+	sleep, ok := xexec.Which("sleep")
+	if !ok {
+		t.Skip("sleep not found")
+	}
+
+	cmd := xexec.New(sleep, "100").WithTimeout(50 * time.Millisecond)
+	cmd.DisableLogger()
+
+	_, err := cmd.Run()
+	assert.Error(t, err)
+	assert.True(t, cmd.TimedOut())
+}
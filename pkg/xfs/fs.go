@@ -11,6 +11,11 @@ func Exists(filename string) bool {
 	return err == nil || !os.IsNotExist(err)
 }
 
+func IsDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
 func EnsureDir(dir string, perm os.FileMode) error {
 	if Exists(dir) {
 		return nil